@@ -0,0 +1,177 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"math"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// defaultUnlockDuration is used when personal_unlockAccount gets no duration.
+const defaultUnlockDuration = 300 * time.Second
+
+// newKeystore opens the encrypted keystore directory, an empty dir means the
+// gateway manages no accounts.
+func newKeystore(dir string) *keystore.KeyStore {
+	if dir == "" {
+		return nil
+	}
+	return keystore.NewKeyStore(dir, keystore.StandardScryptN, keystore.StandardScryptP)
+}
+
+func (s *Server) accountsKeystore() (*keystore.KeyStore, error) {
+	if s.keystore == nil {
+		return nil, newRPCError(ErrCodeServer, "no keystore configured")
+	}
+	return s.keystore, nil
+}
+
+// eth_accounts returns the addresses of the managed accounts.
+func (s *Server) eth_accounts() ([]common.Address, error) {
+	addrs := []common.Address{}
+	if s.keystore == nil {
+		return addrs, nil
+	}
+	for _, a := range s.keystore.Accounts() {
+		addrs = append(addrs, a.Address)
+	}
+	return addrs, nil
+}
+
+func (s *Server) personal_newAccount(password string) (common.Address, error) {
+	ks, err := s.accountsKeystore()
+	if err != nil {
+		return common.Address{}, err
+	}
+	a, err := ks.NewAccount(password)
+	if err != nil {
+		return common.Address{}, err
+	}
+	log.Println("personal_newAccount:", a.Address.Hex())
+	return a.Address, nil
+}
+
+// personal_unlockAccount unlocks addr for duration seconds, 300 by default,
+// a zero duration keeps it unlocked until personal_lockAccount or restart.
+// Every caller can use an unlocked account, so unlocking must be allowed by
+// the config.
+func (s *Server) personal_unlockAccount(addr common.Address, password string, duration *uint64) (bool, error) {
+	if !s.allowInsecureUnlock {
+		return false, newRPCError(ErrCodeServer, "account unlock with HTTP access is forbidden")
+	}
+	ks, err := s.accountsKeystore()
+	if err != nil {
+		return false, err
+	}
+	const max = uint64(time.Duration(math.MaxInt64) / time.Second)
+	d := defaultUnlockDuration
+	if duration != nil {
+		if *duration > max {
+			return false, invalidParams("unlock duration too large")
+		}
+		d = time.Duration(*duration) * time.Second
+	}
+	if err := ks.TimedUnlock(accounts.Account{Address: addr}, password, d); err != nil {
+		log.Println("personal_unlockAccount", addr.Hex(), "error:", err)
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *Server) personal_lockAccount(addr common.Address) (bool, error) {
+	ks, err := s.accountsKeystore()
+	if err != nil {
+		return false, err
+	}
+	return ks.Lock(addr) == nil, nil
+}
+
+// txFromParams builds the transaction described by the call parameters,
+// nonce, gas and gas price default to the sender's next nonce and the
+// gateway's fixed gas and price.
+func (s *Server) txFromParams(para params) (*types.Transaction, error) {
+	if !common.IsHexAddress(para.From) {
+		return nil, invalidParams("invalid from address %q", para.From)
+	}
+	var to *common.Address
+	if para.To != "" {
+		if !common.IsHexAddress(para.To) {
+			return nil, invalidParams("invalid to address %q", para.To)
+		}
+		addr := common.HexToAddress(para.To)
+		to = &addr
+	}
+
+	value, err := s.units.parseWei(para.Value)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	if para.Data != "" {
+		if data, err = hexutil.Decode(para.Data); err != nil {
+			return nil, invalidParams("invalid data: %v", err)
+		}
+	}
+
+	gas := GASPRICE
+	if para.Gas != "" {
+		if gas, err = hexutil.DecodeUint64(para.Gas); err != nil {
+			return nil, invalidParams("invalid gas: %v", err)
+		}
+	}
+	gasPrice := s.units.minGasPrice()
+	if para.GasPrice != "" {
+		if gasPrice, err = hexutil.DecodeBig(para.GasPrice); err != nil {
+			return nil, invalidParams("invalid gasPrice: %v", err)
+		}
+	}
+	if err := s.units.checkGasPrice(gasPrice); err != nil {
+		return nil, err
+	}
+
+	var nonce uint64
+	if para.Nonce != "" {
+		if nonce, err = hexutil.DecodeUint64(para.Nonce); err != nil {
+			return nil, invalidParams("invalid nonce: %v", err)
+		}
+	} else if nonce, err = s.cli.GetNonce(para.From); err != nil {
+		return nil, err
+	}
+
+	return types.NewTx(&types.LegacyTx{
+		Nonce:    nonce,
+		To:       to,
+		Value:    s.units.toWei(value).ToInt(),
+		Gas:      gas,
+		GasPrice: gasPrice,
+		Data:     data,
+	}), nil
+}
+
+// signTx builds and signs the transaction with the unlocked "from" account.
+func (s *Server) signTx(para params) (*types.Transaction, error) {
+	ks, err := s.accountsKeystore()
+	if err != nil {
+		return nil, err
+	}
+	tx, err := s.txFromParams(para)
+	if err != nil {
+		return nil, err
+	}
+
+	from := accounts.Account{Address: common.HexToAddress(para.From)}
+	if !ks.HasAddress(from.Address) {
+		return nil, newRPCError(ErrCodeServer, "unknown account %v", from.Address.Hex())
+	}
+	signed, err := ks.SignTx(from, tx, s.chainId)
+	if errors.Is(err, keystore.ErrLocked) {
+		return nil, newRPCError(ErrCodeServer, "authentication needed: password or unlock")
+	}
+	return signed, err
+}
@@ -1,887 +1,749 @@
 package api
 
 import (
-	"encoding/binary"
+	"bytes"
+	"context"
 	"encoding/hex"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"math/big"
 	"metamaskServer/client"
 	"net/http"
-	"strconv"
+	"strings"
+
+	"kortho/block"
+	"kortho/transaction"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/goinggo/mapstructure"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gorilla/websocket"
 )
 
-func NewServer(addr, chainId, networkId, ethTo string) *Server {
-	return &Server{cli: client.New(addr, ethTo), chainId: chainId, networkId: networkId}
+func NewServer(cfg *Config) (*Server, error) {
+	chainId, ok := parseChainId(cfg.ChainId)
+	if !ok {
+		return nil, fmt.Errorf("invalid chainId %q", cfg.ChainId)
+	}
+	if cfg.Decimals < 0 || cfg.Decimals > weiDecimals {
+		return nil, fmt.Errorf("invalid decimals %v", cfg.Decimals)
+	}
+	txIndexPath := cfg.TxIndexPath
+	if txIndexPath == "" {
+		txIndexPath = defaultTxIndexPath
+	}
+	txHashes, err := newTxHashIndex(txIndexPath)
+	if err != nil {
+		return nil, err
+	}
+	errs, err := loadErrorABI(cfg.ErrorABIs)
+	if err != nil {
+		return nil, err
+	}
+	s := newServer(client.New(cfg.RpcAddr, cfg.EthTo, chainId), cfg)
+	s.txHashes = txHashes
+	s.errorABI = errs
+	s.keystore = newKeystore(cfg.KeystoreDir)
+	return s, nil
+}
+
+func newServer(cli client.Client, cfg *Config) *Server {
+	batchLimit := cfg.BatchLimit
+	if batchLimit <= 0 {
+		batchLimit = defaultBatchLimit
+	}
+	maxSubs := cfg.MaxSubscriptions
+	if maxSubs <= 0 {
+		maxSubs = defaultMaxSubscriptions
+	}
+	pollInterval := cfg.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = defaultPollInterval
+	} else if pollInterval < minPollInterval {
+		pollInterval = minPollInterval
+	}
+	filterTimeout := cfg.FilterTimeout
+	if filterTimeout <= 0 {
+		filterTimeout = defaultFilterTimeout
+	} else if filterTimeout < minFilterTimeout {
+		filterTimeout = minFilterTimeout
+	}
+	maxFilters := cfg.MaxFilters
+	if maxFilters <= 0 {
+		maxFilters = defaultMaxFilters
+	}
+	maxFiltersTotal := cfg.MaxFiltersTotal
+	if maxFiltersTotal <= 0 {
+		maxFiltersTotal = defaultMaxFiltersTotal
+	}
+	trustedProxies := make(map[string]bool)
+	for _, proxy := range cfg.TrustedProxies {
+		trustedProxies[strings.TrimSpace(proxy)] = true
+	}
+	decimals := cfg.Decimals
+	if decimals <= 0 {
+		decimals = defaultDecimals
+	}
+	logsMaxRange := cfg.LogsMaxRange
+	if logsMaxRange == 0 {
+		logsMaxRange = defaultLogsMaxRange
+	}
+	logsMaxResults := cfg.LogsMaxResults
+	if logsMaxResults <= 0 {
+		logsMaxResults = defaultLogsMaxResults
+	}
+	logsChunkSize := cfg.LogsChunkSize
+	if logsChunkSize == 0 {
+		logsChunkSize = defaultLogsChunkSize
+	}
+	chainId, _ := parseChainId(cfg.ChainId)
+	s := &Server{
+		cli:          cli,
+		chainId:      chainId,
+		networkId:    cfg.NetworkId,
+		batchLimit:   batchLimit,
+		maxSubs:      maxSubs,
+		pollInterval: pollInterval,
+		methods:      newRegistry(cfg.Namespaces),
+		filters:      newFilterManager(filterTimeout, maxFilters, maxFiltersTotal),
+		units:        newUnits(decimals),
+		chainConfig:  newChainConfig(chainId),
+		wsUpgrader:   newWsUpgrader(cfg.WsOrigins),
+
+		trustedProxies: trustedProxies,
+
+		rejectUnprotected:   cfg.RejectUnprotectedTxs,
+		allowInsecureUnlock: cfg.AllowInsecureUnlock,
+		localCalls:          cfg.LocalCalls,
+		verifyCalls:         cfg.VerifyCalls,
+
+		logsMaxRange:   logsMaxRange,
+		logsMaxResults: logsMaxResults,
+		logsChunkSize:  logsChunkSize,
+	}
+	s.txHashes, _ = newTxHashIndex("")
+	s.registerMethods()
+	go s.filters.loop(&s.pendingTxs)
+	return s
+}
+
+// registerMethods registers every supported JSON-RPC method.
+func (s *Server) registerMethods() {
+	s.methods.register(ETH_CHAINID, s.eth_chainId)
+	s.methods.register(NET_VERSION, s.net_version)
+	s.methods.register(WEB3_CLIENTVERSION, s.web3_clientVersion)
+	s.methods.registerIn(signNamespace, ETH_SENDTRANSACTION, s.eth_sendTransaction)
+	s.methods.register(ETH_SENDRAWTRANSACTION, s.eth_sendRawTransaction)
+	s.methods.registerIn(signNamespace, ETH_SIGNTRANSACTION, s.eth_signTransaction)
+	s.methods.register(ETH_CALL, s.eth_call)
+	s.methods.register(ETH_CALLMANY, s.eth_callMany)
+	s.methods.register(ETH_SIMULATEV1, s.eth_simulateV1)
+	s.methods.register(ETH_ESTIMATEGAS, s.eth_estimateGas)
+	s.methods.register(ETH_BLOCKNUMBER, s.eth_blockNumber)
+	s.methods.register(ETH_GETBALANCE, s.eth_getBalance)
+	s.methods.register(ETH_GETBLOCKBYHASH, s.eth_getBlockByHash)
+	s.methods.register(ETH_GETBLOCKBYNUMBER, s.eth_getBlockByNumber)
+	s.methods.register(ETH_GETTRANSACTIONBYHASH, s.eth_getTransactionByHash)
+	s.methods.register(ETH_GETTRANSACTIONRECEIPT, s.eth_getTransactionReceipt)
+	s.methods.register(ETH_GASPRICE, s.eth_gasPrice)
+	s.methods.register(EHT_GETCODE, s.eth_getCode)
+	s.methods.register(ETH_GETTRANSACTIONCOUNT, s.eth_getTransactionCount)
+	s.methods.register(ETH_GETLOGS, s.eth_getLogs)
+	s.methods.register(ETH_GETSTORAGEAT, s.eth_getStorageAt)
+	s.methods.register(ETH_SUBSCRIBE, s.eth_subscribe)
+	s.methods.register(ETH_UNSUBSCRIBE, s.eth_unsubscribe)
+	s.methods.register(ETH_NEWFILTER, s.eth_newFilter)
+	s.methods.register(ETH_NEWBLOCKFILTER, s.eth_newBlockFilter)
+	s.methods.register(ETH_NEWPENDINGTRANSACTIONFILTER, s.eth_newPendingTransactionFilter)
+	s.methods.register(ETH_GETFILTERCHANGES, s.eth_getFilterChanges)
+	s.methods.register(ETH_GETFILTERLOGS, s.eth_getFilterLogs)
+	s.methods.register(ETH_UNINSTALLFILTER, s.eth_uninstallFilter)
+	s.methods.register(ETH_ACCOUNTS, s.eth_accounts)
+	s.methods.register(PERSONAL_NEWACCOUNT, s.personal_newAccount)
+	s.methods.register(PERSONAL_UNLOCKACCOUNT, s.personal_unlockAccount)
+	s.methods.register(PERSONAL_LOCKACCOUNT, s.personal_lockAccount)
+	s.methods.registerIn(signNamespace, ETH_SIGN, s.eth_sign)
+	s.methods.registerIn(signNamespace, ETH_SIGNTYPEDDATA_V4, s.eth_signTypedData_v4)
+	s.methods.register(PERSONAL_SIGN, s.personal_sign)
+	s.methods.register(PERSONAL_ECRECOVER, s.personal_ecRecover)
 }
 
 func (s *Server) HandRequest(w http.ResponseWriter, req *http.Request) {
+	if websocket.IsWebSocketUpgrade(req) {
+		s.HandWebsocket(w, req)
+		return
+	}
 	defer req.Body.Close()
+	w.Header().Set("Content-Type", "application/json")
 
 	body, err := ioutil.ReadAll(req.Body)
 	if err != nil {
-		w.Write([]byte(err.Error()))
+		writeError(w, "", nil, invalidRequest("%v", err))
 		return
 	}
+	log.Println("request body:", string(body))
 
-	reqData := make(map[string]interface{})
-	if err := json.Unmarshal(body, &reqData); err != nil {
-		w.Write([]byte(err.Error()))
+	ctx := context.WithValue(req.Context(), clientKey{}, s.clientAddr(req))
+	if isBatch(body) {
+		s.handBatch(ctx, w, body)
 		return
 	}
 
-	method, err := getString(reqData, "method")
-	if err != nil {
-		w.Write([]byte(err.Error()))
+	var msg jsonrpcMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		writeError(w, "", nil, newRPCError(ErrCodeParse, "parse error: %v", err))
 		return
 	}
+	if resp := s.handleMsg(ctx, &msg); resp != nil {
+		w.Write(resp)
+	}
+}
 
-	jsonrpc, err := getString(reqData, "jsonrpc")
-	if err != nil {
-		log.Println("getString error:", err)
-		w.Write([]byte(err.Error()))
+// handBatch executes the elements of a JSON-RPC 2.0 batch one after another,
+// so writes such as consecutive nonces reach the node in request order, and
+// writes the responses back as an array. Notifications (no id) are executed
+// but get no entry in the response array.
+func (s *Server) handBatch(ctx context.Context, w io.Writer, body []byte) {
+	var reqs []json.RawMessage
+	if err := json.Unmarshal(body, &reqs); err != nil {
+		writeError(w, "", nil, newRPCError(ErrCodeParse, "parse error: %v", err))
 		return
 	}
-	id, err := getValue(reqData, "id")
-	if err != nil {
-		log.Println("getValue:", err)
-		w.Write([]byte(err.Error()))
+	if len(reqs) == 0 {
+		writeError(w, "", nil, invalidRequest("empty batch"))
 		return
 	}
+	if len(reqs) > s.batchLimit {
+		writeError(w, "", nil, invalidRequest("batch too large: %v requests, limit is %v", len(reqs), s.batchLimit))
+		return
+	}
+	log.Println("batch request size:", len(reqs))
 
-	log.Println("request body:", string(body))
-	log.Printf("method:%v\n", method)
-	log.Println("jsonrpc:", jsonrpc, "id:", id)
-
-	switch method {
-	case ETH_CHAINID:
-		chainId := s.eth_chainId()
-		resp, err := json.Marshal(responseBody{JsonRPC: jsonrpc, Id: id, Result: chainId})
-		if err != nil {
-			log.Println("eth_chainId Marshal error:", err)
-			w.Write([]byte(err.Error()))
-		} else {
-			fmt.Println("eth_chainId success res>>>", chainId)
-			w.Write(resp)
-		}
-	case NET_VERSION:
-		networkId := s.net_version()
-		resp, err := json.Marshal(responseBody{JsonRPC: jsonrpc, Id: id, Result: networkId})
-		if err != nil {
-			log.Println("net_version error:", err)
-			w.Write([]byte(err.Error()))
-		} else {
-			log.Println("net_version success res>>>", networkId)
-			w.Write(resp)
-		}
-
-	case ETH_SENDTRANSACTION:
-		hs, err := s.eth_sendTransaction(reqData)
-		if err != nil {
-			log.Println("eth_sendTransaction error:", err)
-			w.Write([]byte(err.Error()))
-		} else {
-			resp, err := json.Marshal(responseBody{JsonRPC: jsonrpc, Id: id, Result: hs})
-			if err != nil {
-				log.Println("eth_sendTransaction Marshal error:", err)
-				w.Write([]byte(err.Error()))
-			} else {
-				log.Println("eth_sendTransaction success res>>>", hs)
-				w.Write(resp)
-			}
-		}
-	case ETH_CALL:
-		ret, err := s.eth_call(reqData)
-		if ret == "" && err != nil {
-			log.Println("eth_call error:", err)
-			w.Write([]byte(err.Error()))
-		} else if err != nil {
-			var RetErr ErrorBody
-			RetErr.Code = -4677
-			RetErr.Message = err.Error()
-			if len(ret) > 0 {
-				btret := common.Hex2Bytes(ret)
-				lenth := binary.BigEndian.Uint32(btret[64:68])
-				data := btret[68 : lenth+68]
-				errMsg := string(data)
-				RetErr.Message = RetErr.Message + ": " + errMsg
-			}
-			RetErr.Data = "0x" + ret
-
-			resp, err := json.Marshal(responseErr{JsonRPC: jsonrpc, Id: id, Error: &RetErr})
-			if err != nil {
-				log.Println("eth_call Marshal error:", err)
-				w.Write([]byte(err.Error()))
-			} else {
-				log.Println("eth_call success ret>>>", ret)
-				w.Write(resp)
-			}
-		} else {
-			res := "0x" + ret
-			log.Println("eth_call success res>>>", res)
-			resp, err := json.Marshal(responseBody{JsonRPC: jsonrpc, Id: id, Result: res})
-			if err != nil {
-				log.Println("eth_call Marshal error:", err)
-				w.Write([]byte(err.Error()))
-			} else {
-				log.Println("eth_call success res>>>", res)
-				w.Write(resp)
-			}
-		}
-	case ETH_BLOCKNUMBER:
-		num, err := s.eth_blockNumber()
-		if err != nil {
-			log.Println("eth_blockNumber error:", err)
-			w.Write([]byte(err.Error()))
-		} else {
-			log.Println("eth_blockNumber =", num)
-			resNum := fmt.Sprintf("%X", num)
-			log.Println("resNum =", resNum)
-
-			resp, err := json.Marshal(responseBody{JsonRPC: jsonrpc, Id: id, Result: ("0x" + resNum)})
-			if err != nil {
-				log.Println("eth_blockNumber Marshal error:", err)
-				w.Write([]byte(err.Error()))
-			} else {
-				log.Println("eth_blockNumber success res>>>", "0x"+resNum)
-				w.Write(resp)
-			}
-		}
-	case ETH_GETBALANCE:
-		from, err := getParam(reqData)
-		if err != nil {
-			log.Println("getParam error:", err)
-			w.Write([]byte(err.Error()))
-		} else {
-			blc, err := s.eth_getBalance(from)
-			if err != nil {
-				if err.Error() == "rpc error: code = Unknown desc = NotExist" {
-					resp, err := json.Marshal(responseBody{JsonRPC: jsonrpc, Id: id, Result: "0x0"})
-					if err != nil {
-						log.Println("eth_getBalance Marshal error:", err)
-						w.Write([]byte(err.Error()))
-					} else {
-						log.Println("eth_getBalance success res>>>", from, "NotExist")
-						w.Write(resp)
-					}
-					break
-				}
-				log.Println("eth_getBalance error:", err)
-				w.Write([]byte(err.Error()))
-			} else {
-				//metamask's decimal is 18,kto is 11,we need do blc*Pow10(7).
-				bigB := new(big.Int).SetUint64(blc)
-				bl := bigB.Mul(bigB, big.NewInt(10000000))
-
-				resBalance := fmt.Sprintf("%X", bl)
-
-				resp, err := json.Marshal(responseBody{JsonRPC: jsonrpc, Id: id, Result: ("0x" + resBalance)})
-				if err != nil {
-					log.Println("eth_getBalance Marshal error:", err)
-					w.Write([]byte(err.Error()))
-				} else {
-					log.Println("eth_getBalance success res>>>", from, "0x"+resBalance)
-					w.Write(resp)
-				}
-			}
-		}
-	case ETH_GETBLOCKBYHASH:
-		hash, err := getParam(reqData)
-		if err != nil {
-			log.Println("getParam error:", err)
-			w.Write([]byte(err.Error()))
-		} else {
-			blk, err := s.eth_getBlockByHash(hash)
-			if err != nil {
-				log.Println("eth_getBlockByHash error:", err)
-				w.Write([]byte(err.Error()))
-			} else {
-				resp, err := json.Marshal(responseBlock{JsonRPC: jsonrpc, Id: id, Result: blk})
-				if err != nil {
-					log.Println("eth_getBlockByHash Marshal error:", err)
-					w.Write([]byte(err.Error()))
-				} else {
-					log.Println("eth_getBlockByHash success res>>>", blk.Hash)
-					w.Write(resp)
-				}
-			}
-		}
-	case ETH_GETBLOCKBYNUMBER:
-		strNum, err := getParam(reqData)
-		if err != nil {
-			log.Println("getParam error:", err)
-			w.Write([]byte(err.Error()))
-		} else {
-			num, err := strconv.ParseUint(strNum[2:], 16, 64)
-			if err != nil {
-				log.Println("ParseUint error:", err)
-				w.Write([]byte(err.Error()))
-			}
-
-			blk, err := s.eth_getBlockByNumber(num)
-			if err != nil {
-				log.Println("eth_getBlockByNumber error:", err)
-				w.Write([]byte(err.Error()))
-			} else {
-				resp, err := json.Marshal(responseBlock{JsonRPC: jsonrpc, Id: id, Result: blk})
-				if err != nil {
-					log.Println("eth_getBlockByNumber Marshal error:", err)
-					w.Write([]byte(err.Error()))
-				} else {
-					log.Println("eth_getBlockByNumber success res>>>", num)
-					w.Write(resp)
-				}
-			}
-		}
-	case ETH_GETTRANSACTIONBYHASH:
-		hash, err := getParam(reqData)
-		if err != nil {
-			log.Println("getParam error:", err)
-			w.Write([]byte(err.Error()))
-		} else {
-			tx, err := s.eth_getTransactionByHash(hash)
-			if err != nil {
-				log.Println("eth_getTransactionByHash error:", err)
-				w.Write([]byte(err.Error()))
-			} else {
-				resp, err := json.Marshal(responseTransaction{JsonRPC: jsonrpc, Id: id, Result: tx})
-				if err != nil {
-					log.Println("eth_gasPrice Marshal error:", err)
-					w.Write([]byte(err.Error()))
-				} else {
-					log.Printf("eth_getTransactionByHash formart >>>>>>>>>>>>>>>>>: %s\n", string(resp))
-					log.Println("eth_getTransactionByHash success res>>>", tx.Hash)
-					w.Write(resp)
-				}
-			}
-		}
-	case ETH_GASPRICE:
-		pric, err := s.eth_gasPrice()
-		if err != nil {
-			log.Println("eth_gasPrice error:", err)
-			w.Write([]byte(err.Error()))
-		} else {
-			resp, err := json.Marshal(responseBody{JsonRPC: jsonrpc, Id: id, Result: pric})
-			if err != nil {
-				log.Println("eth_gasPrice Marshal error:", err)
-				w.Write([]byte(err.Error()))
-			} else {
-				log.Println("eth_gasPrice success res>>>", pric)
-				w.Write(resp)
-			}
-		}
-	case EHT_GETCODE:
-		addr, err := getParam(reqData)
-		if err != nil {
-			log.Println("getParam error:", err)
-			w.Write([]byte(err.Error()))
-		} else {
-			code, err := s.eth_getCode(addr)
-			if err != nil {
-				log.Println("eth_getCode error:", err)
-				w.Write([]byte(err.Error()))
-			} else {
-				resp, err := json.Marshal(responseBody{JsonRPC: jsonrpc, Id: id, Result: code})
-				if err != nil {
-					log.Println("eth_getBalance Marshal error:", err)
-					w.Write([]byte(err.Error()))
-				} else {
-					log.Println("eth_getCode success res>>>", code)
-					w.Write(resp)
-				}
-			}
-		}
-	case ETH_GETTRANSACTIONCOUNT:
-		addr, err := getParam(reqData)
-		if err != nil {
-			log.Println("getParam error:", err)
-			w.Write([]byte(err.Error()))
-		} else {
-			count, err := s.eth_getTransactionCount(addr)
-			if err != nil {
-				log.Println("eth_getTransactionCount error:", err)
-				w.Write([]byte(err.Error()))
-			} else {
-				hexCount := fmt.Sprintf("%X", count)
-				resp, err := json.Marshal(responseBody{JsonRPC: jsonrpc, Id: id, Result: ("0x" + hexCount)})
-				if err != nil {
-					log.Println("eth_getTransactionCount Marshal error:", err)
-					w.Write([]byte(err.Error()))
-				} else {
-					log.Println("eth_getTransactionCount success res>>>", "addr:", addr, "nonce", count)
-					w.Write(resp)
-				}
-			}
-		}
-	case ETH_ESTIMATEGAS:
-		ret, err := s.eth_estimateGas(reqData)
-		if ret == "" && err != nil {
-			log.Println("eth_estimateGas error:", err)
-			w.Write([]byte(err.Error()))
-		} else if err != nil {
-			var RetErr ErrorBody
-			RetErr.Code = -4677
-			RetErr.Message = err.Error()
-			if len(ret) > 0 {
-				btret := common.Hex2Bytes(ret)
-				lenth := binary.BigEndian.Uint32(btret[64:68])
-				data := btret[68 : lenth+68]
-				errMsg := string(data)
-				RetErr.Message = RetErr.Message + ": " + errMsg
-			}
-			RetErr.Data = "0x" + ret
-
-			resp, err := json.Marshal(responseErr{JsonRPC: jsonrpc, Id: id, Error: &RetErr})
-			if err != nil {
-				log.Println("eth_estimateGas Marshal error:", err)
-				w.Write([]byte(err.Error()))
-			} else {
-				log.Println("eth_estimateGas success ret>>>", ret)
-				w.Write(resp)
-			}
-		} else {
-			res := "0x" + ret
-			log.Println("eth_estimateGas success res>>>", res)
-			resp, err := json.Marshal(responseBody{JsonRPC: jsonrpc, Id: id, Result: res})
-			if err != nil {
-				log.Println("eth_estimateGas Marshal error:", err)
-				w.Write([]byte(err.Error()))
-			} else {
-				log.Println("eth_estimateGas success res>>>", res)
-				w.Write(resp)
-			}
-		}
-	case ETH_SENDRAWTRANSACTION:
-		rawTx, err := getParam(reqData)
-		if err != nil {
-			log.Println("getParam error:", err)
-			w.Write([]byte(err.Error()))
-		} else {
-			hash, err := s.eth_sendRawTransaction(rawTx)
-			if err != nil {
-				log.Println("eth_sendRawTransaction error:", err)
-				w.Write([]byte(err.Error()))
-			} else {
-				resp, err := json.Marshal(responseBody{JsonRPC: jsonrpc, Id: id, Result: hash})
-				if err != nil {
-					log.Println("eth_sendRawTransaction Marshal error:", err)
-					w.Write([]byte(err.Error()))
-				} else {
-					log.Println("eth_sendRawTransaction success res>>>", hash)
-					w.Write(resp)
-				}
-			}
-		}
-	case ETH_GETTRANSACTIONRECEIPT:
-		hash, err := getParam(reqData)
-		if err != nil {
-			log.Println("getParam error:", err)
-			w.Write([]byte(err.Error()))
-		} else {
-			tc, err := s.eth_getTransactionReceipt(hash)
-			if err != nil {
-				log.Println("eth_getTransactionReceipt error:", err)
-				w.Write([]byte(err.Error()))
-			} else {
-
-				resp, err := json.Marshal(responseReceipt{JsonRPC: jsonrpc, Id: id, Result: tc})
-				if err != nil {
-					log.Println("eth_getTransactionReceipt Marshal error:", err)
-					w.Write([]byte(err.Error()))
-				} else {
-					log.Println("eth_getTransactionReceipt success res>>>", tc.TransactionHash, "contractAddr:", tc.ContractAddress, "status:", tc.Status, "blockNum:", tc.BlockNumber, "blockHash:", tc.BlockHash)
-					for i, lg := range tc.Logs {
-						log.Printf("tc.Logs>>>>>>>>>>>>>>[%v]:addr: %v,data: %v,topics: %v", i, lg.Address, hex.EncodeToString(lg.Data), lg.Topics)
-					}
-
-					log.Printf("formart>>>>>>>>>>>>>>>>>: %s\n", string(resp))
-					w.Write(resp)
-				}
-			}
-		}
-
-	case ETH_GETLOGS:
-		res, err := s.eth_getLogs(reqData)
-		if err != nil {
-			log.Println("eth_getLogs error:", err)
-			w.Write([]byte(err.Error()))
-		} else {
-			resp, err := json.Marshal(responseBody{JsonRPC: jsonrpc, Id: id, Result: res})
-			if err != nil {
-				log.Println("eth_getLogs Marshal error:", err)
-				w.Write([]byte(err.Error()))
-			} else {
-				log.Println("eth_getLogs success res>>>", res)
-				w.Write(resp)
-			}
-		}
-	case WEB3_CLIENTVERSION:
-		res := s.web3_clientVersion()
-
-		resp, err := json.Marshal(responseBody{JsonRPC: jsonrpc, Id: id, Result: res})
-		if err != nil {
-			log.Println("web3_clientVersion Marshal error:", err)
-			w.Write([]byte(err.Error()))
-		} else {
-			fmt.Println("web3_clientVersion success res>>>", res)
-			w.Write(resp)
-		}
-
-	case ETH_GETSTORAGEAT:
-		res, err := s.eth_getStorageAt(reqData)
-		//res := "0x00000000000000000000000000000000000000000000000000000000000004d2"
-		if err != nil {
-			log.Println("eth_getStorageAt error:", err)
-			w.Write([]byte(err.Error()))
-		} else {
-			resp, err := json.Marshal(responseBody{JsonRPC: jsonrpc, Id: id, Result: res})
-			if err != nil {
-				log.Println("eth_getStorageAt Marshal error:", err)
-				w.Write([]byte(err.Error()))
-			} else {
-				fmt.Println("eth_getStorageAt success res>>>", res)
-				w.Write(resp)
-			}
+	res := make([]json.RawMessage, 0, len(reqs))
+	for _, raw := range reqs {
+		var msg jsonrpcMessage
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			res = append(res, errResponse("", nil, invalidRequest("%v", err)))
+			continue
 		}
-	case ETH_SIGNTRANSACTION:
-		signatrue, err := s.eth_signTransaction(reqData)
-		if err != nil {
-			log.Println("eth_signTransaction error:", err)
-			w.Write([]byte(err.Error()))
-		} else {
-			resp, err := json.Marshal(responseBody{JsonRPC: jsonrpc, Id: id, Result: signatrue})
-			if err != nil {
-				log.Println("eth_signTransaction Marshal error:", err)
-				w.Write([]byte(err.Error()))
-			} else {
-				log.Println("eth_signTransaction success res>>>", signatrue)
-				w.Write(resp)
-			}
+		if r := s.handleMsg(ctx, &msg); r != nil {
+			res = append(res, r)
 		}
+	}
+	if len(res) == 0 { //only notifications
+		return
+	}
+	resp, err := json.Marshal(res)
+	if err != nil {
+		log.Println("batch Marshal error:", err)
+		writeError(w, "", nil, newRPCError(ErrCodeInternal, "%v", err))
+		return
+	}
+	w.Write(resp)
+}
 
-	default:
-		log.Printf("Error unsupport method:%v\n", method)
-		w.Write([]byte(fmt.Errorf("Unsupport method:%v", method).Error()))
+// parseChainId parses a hex or decimal chain id.
+func parseChainId(id string) (*big.Int, bool) {
+	chainId, ok := new(big.Int).SetString(id, 0)
+	if !ok {
+		return new(big.Int), false
 	}
-	return
+	return chainId, true
 }
 
-func (s *Server) eth_chainId() string {
-	return s.chainId
+func (s *Server) eth_chainId() (*hexutil.Big, error) {
+	return (*hexutil.Big)(s.chainId), nil
 }
 
-func (s *Server) net_version() string {
-	return s.networkId
+func (s *Server) net_version() (string, error) {
+	return s.networkId, nil
 }
 
-func (s *Server) eth_signTransaction(mp map[string]interface{}) (string, error) {
+// eth_signTransaction signs the transaction with the unlocked "from" account
+// without submitting it, the raw result can be sent with eth_sendRawTransaction.
+func (s *Server) eth_signTransaction(para params) (*SignTransactionResult, error) {
+	log.Printf("eth_signTransaction params: from=%v,to=%v,gas=%v,gasPrice=%v,value=%v,data=%v,nonce=%v\n", para.From, para.To, para.Gas, para.GasPrice, para.Value, para.Data, para.Nonce)
 
-	v, ok := mp["params"]
-	if !ok {
-		return "", errors.New(fmt.Sprintf("'%s' not exist", "params"))
+	tx, err := s.signTx(para)
+	if err != nil {
+		return nil, err
 	}
-	if _, ok := v.([]interface{}); !ok {
-		return "", errors.New("eth_signTransaction: params is wrong!")
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return nil, err
 	}
+	return &SignTransactionResult{Raw: raw, Tx: tx}, nil
+}
 
-	Para := v.([]interface{})
-	var para params
+// eth_sendTransaction signs the transaction with the unlocked "from"
+// account and submits it like eth_sendRawTransaction.
+func (s *Server) eth_sendTransaction(para params) (string, error) {
+	log.Printf("eth_sendTransaction params: from=%v,to=%v,gas=%v,gasPrice=%v,value=%v,data=%v\n", para.From, para.To, para.Gas, para.GasPrice, para.Value, para.Data)
 
-	err := mapstructure.Decode(Para[0].(map[string]interface{}), &para)
+	tx, err := s.signTx(para)
 	if err != nil {
 		return "", err
 	}
-	log.Printf("eth_signTransaction params: from=%v,to=%v,gas=%v,gasPrice=%v,value=%v,data=%v\n", para.From, para.To, para.Gas, para.GasPrice, para.Value, para.Data)
-	return "no private key", nil
-	// return "res", nil
-}
-
-func (s *Server) eth_sendTransaction(mp map[string]interface{}) (string, error) {
-	v, ok := mp["params"]
-	if !ok {
-		return "", errors.New(fmt.Sprintf("'%s' not exist", "params"))
-	}
-	if _, ok := v.([]interface{}); !ok {
-		return "", errors.New("eth_sendTransaction: params is wrong!")
-	}
-
-	Para := v.([]interface{})
-	var para params
-
-	err := mapstructure.Decode(Para[0].(map[string]interface{}), &para)
+	raw, err := tx.MarshalBinary()
 	if err != nil {
 		return "", err
 	}
-	log.Printf("eth_sendTransaction params: from=%v,to=%v,gas=%v,gasPrice=%v,value=%v,data=%v\n", para.From, para.To, para.Gas, para.GasPrice, para.Value, para.Data)
+	return s.eth_sendRawTransaction(hexutil.Encode(raw))
+}
 
-	//send common transaction
-	vl, err := strconv.ParseUint(para.Value[2:], 16, 64)
+//send signed transaction
+func (s *Server) eth_sendRawTransaction(rawTx string) (string, error) {
+	log.Println("eth_sendRawTransaction rawTx=", rawTx)
+	raw, err := hexutil.Decode(rawTx)
 	if err != nil {
-		fmt.Println("ParseUint error:", err)
+		return "", invalidParams("invalid raw transaction: %v", err)
+	}
+	if err := s.checkRawTx(raw); err != nil {
 		return "", err
 	}
-
-	hash, err := s.cli.SendTransaction(para.From, para.To, PRI, vl)
+	hash, err := s.cli.SendRawTransaction(rawTx)
 	if err != nil {
 		return "", err
 	}
-	return hash, nil
+
+	ethHash := crypto.Keccak256Hash(raw)
+	s.indexTx(ethHash, hash, raw)
+	log.Println("eth_sendRawTransaction eth hash:", ethHash.Hex(), "kto hash:", hash)
+	s.pendingTxs.send(ethHash.Hex())
+	return ethHash.Hex(), nil
 }
 
-//send signed transaction
-func (s *Server) eth_sendRawTransaction(rawTx string) (string, error) {
-	log.Println("eth_sendRawTransaction rawTx=", rawTx)
-	return s.cli.SendRawTransaction(rawTx)
+// checkRawTx rejects transactions signed for another chain, transactions
+// without EIP-155 replay protection when configured, values kortho cannot
+// represent and gas prices kortho cannot represent or below MINGASPRICE.
+func (s *Server) checkRawTx(raw []byte) error {
+	var tx types.Transaction
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		return invalidParams("invalid raw transaction: %v", err)
+	}
+	if _, err := s.units.fromWei(tx.Value()); err != nil {
+		return err
+	}
+	if err := s.units.checkGasPrice(tx.GasFeeCap()); err != nil {
+		return err
+	}
+	if _, err := s.units.fromWei(tx.GasTipCap()); err != nil {
+		return err
+	}
+	if !tx.Protected() {
+		if s.rejectUnprotected {
+			return newRPCError(ErrCodeServer, "only replay-protected (EIP-155) transactions allowed over RPC")
+		}
+		return nil
+	}
+	if tx.ChainId().Cmp(s.chainId) != 0 {
+		return newRPCError(ErrCodeServer, "invalid chain id: have %v, want %v", tx.ChainId(), s.chainId)
+	}
+	return nil
 }
 
 //Executes a new message call immediately without creating a transaction on the block chain.
-func (s *Server) eth_call(mp map[string]interface{}) (string, error) {
-	log.Println("eth_call:", mp)
-	v, ok := mp["params"]
-	if !ok {
-		return "", errors.New(fmt.Sprintf("'%s' not exist", "params"))
+//State and block overrides are only supported by executing the call locally.
+func (s *Server) eth_call(para params, blockNr *BlockNumberOrHash, overrides StateOverride, blockOverrides *BlockOverrides) (string, error) {
+	log.Printf("eth_call params: from=%v,to=%v,gas=%v,gasPrice=%v,value=%v,data=%v\n", para.From, para.To, para.Gas, para.GasPrice, para.Value, para.Data)
+	env, err := s.newCallEnv(blockNr, s.localCalls || overrides != nil || blockOverrides != nil)
+	if err != nil {
+		return "", err
 	}
-
-	if _, ok := v.([]interface{}); !ok {
-		return "", errors.New("eth_call: params is wrong!")
+	if env != nil {
+		if err := overrides.apply(env.remote); err != nil {
+			return "", err
+		}
+		blockOverrides.apply(&env.block)
+		return s.localCall(env, para)
 	}
 
-	Para := v.([]interface{})
-	var para params
+	ret, err := s.cli.ContractCall(para.From, para.To, para.Data) //para.From, para.To, PRI, para.Value, "call")
+	if err != nil {
+		return "", s.callError(ret, err)
+	}
+	return "0x" + ret, nil
+}
 
-	err := mapstructure.Decode(Para[0].(map[string]interface{}), &para)
+// localCall executes eth_call on the gateway's EVM, with the caller's gas or
+// the block gas limit.
+func (s *Server) localCall(env *callEnv, para params) (string, error) {
+	gas, err := callGas(para, env.block.GasLimit)
 	if err != nil {
 		return "", err
 	}
-	log.Printf("eth_call params: from=%v,to=%v,gas=%v,gasPrice=%v,value=%v,data=%v\n", para.From, para.To, para.Gas, para.GasPrice, para.Value, para.Data)
-
-	ret, err := s.cli.ContractCall(para.From, para.To, para.Data) //para.From, para.To, PRI, para.Value, "call")
-	if ret == "" {
+	res, err := s.execCall(env, para, gas)
+	if err != nil {
 		return "", err
 	}
-	return ret, err
+	if s.verifyCalls {
+		s.verifyCall(para, res)
+	}
+	if res.failed {
+		return "", s.callError(res.ret, res.err)
+	}
+	return "0x" + res.ret, nil
 }
 
-func (s *Server) eth_blockNumber() (uint64, error) {
-	return s.cli.GetBlockNumber()
+func (s *Server) eth_blockNumber() (hexutil.Uint64, error) {
+	num, err := s.cli.GetBlockNumber()
+	return hexutil.Uint64(num), err
 }
 
-func (s *Server) eth_getBalance(from string) (uint64, error) {
+func (s *Server) eth_getBalance(from string, blockNr *BlockNumberOrHash) (*hexutil.Big, error) {
 	log.Println("GetBalance from=", from)
-	return s.cli.GetBalance(from)
+	if err := s.stateBlock(blockNr); err != nil {
+		return nil, err
+	}
+	blc, err := s.cli.GetBalance(from)
+	if err != nil {
+		if isNotExist(err) {
+			log.Println("eth_getBalance", from, "NotExist")
+			return (*hexutil.Big)(new(big.Int)), nil
+		}
+		return nil, err
+	}
+	return s.units.toWei(blc), nil
 }
 
-func (s *Server) eth_getBlockByHash(hash string) (*Block, error) {
+func (s *Server) eth_getBlockByHash(hash string, fullTx *bool) (*Block, error) {
 	log.Println("GetBlockBy Hash=", hash)
-	b, err := s.cli.GetBlockByHash(hash)
+	b, err := s.cli.GetBlockByHash(strip0x(hash))
 	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
 		return nil, err
 	}
-	var block Block
-	block.Hash = hex.EncodeToString(b.Hash)
-	block.Miner = common.Address{}
-	block.Number = "0x" + fmt.Sprintf("%X", b.Height)
-	block.ParentHash = hex.EncodeToString(b.PrevHash)
-	block.TimeStamp = "0x" + fmt.Sprintf("%X", b.Timestamp)
-
-	return &block, nil
+	return s.newBlock(b, fullTx != nil && *fullTx), nil
 }
 
-func (s *Server) eth_getBlockByNumber(num uint64) (*Block, error) {
-	log.Println("GetBlockByNumber=", num)
+func (s *Server) eth_getBlockByNumber(bn BlockNumber, fullTx *bool) (*Block, error) {
+	log.Println("GetBlockByNumber=", bn)
+	num, err := s.resolveBlockNumber(bn)
+	if err != nil {
+		return nil, err
+	}
+	if !bn.isTag() {
+		head, err := s.cli.GetBlockNumber()
+		if err != nil {
+			return nil, err
+		}
+		if num > head {
+			return nil, nil
+		}
+	}
 	b, err := s.cli.GetBlockByNumber(num)
 	if err != nil {
 		return nil, err
 	}
-	var block Block
-	block.Hash = hex.EncodeToString(b.Hash)
-	block.Miner = common.Address{}
-	block.Number = "0x" + fmt.Sprintf("%X", b.Height)
-	block.ParentHash = hex.EncodeToString(b.PrevHash)
-	block.TimeStamp = "0x" + fmt.Sprintf("%X", b.Timestamp)
-
-	return &block, nil
+	return s.newBlock(b, fullTx != nil && *fullTx), nil
 }
 
+// eth_getTransactionByHash returns null for unknown transactions and ones
+// not yet in a block.
 func (s *Server) eth_getTransactionByHash(hash string) (*Transaction, error) {
 	log.Println("GetTransactionByHash =", hash)
-	if len(hash) > 0 {
-		if hash[:2] == "0x" {
-			hash = hash[2:]
-		}
-	}
-
-	tx, err := s.cli.GetTransactionByHash(hash)
+	tx, err := s.cli.GetTransactionByHash(s.korthoTxHash(hash))
 	if err != nil {
-		return nil, errors.New(err.Error())
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
 	}
 
 	b, err := s.cli.GetBlockByNumber(tx.BlockNumber)
 	if err != nil {
 		log.Println("GetBlockByNumber error==========:", err)
-		return nil, errors.New(err.Error())
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
 	}
-
-	var trs Transaction
-
-	trs.BlockHash = hex.EncodeToString(b.Hash)
-	trs.BlockNumber = "0x" + fmt.Sprintf("%X", b.Height)
-	trs.From = tx.EthFrom.Hex()
-	trs.Gas = "0x" + fmt.Sprintf("%X", GASPRICE)
-	trs.Hash = hex.EncodeToString(tx.Hash)
-	trs.To = tx.EthTo.Hex()
-
-	n, err := s.eth_getTransactionCount(trs.From)
-	if err == nil {
-		trs.Nonce = "0x" + fmt.Sprintf("%X", n)
+	for i, btx := range b.Transactions {
+		if bytes.Equal(btx.Hash, tx.Hash) {
+			return s.newTransaction(tx, b, uint64(i)), nil
+		}
 	}
+	return nil, nil
+}
 
-	if tx.EvmC != nil {
-		if tx.EvmC.Operation == "create" || tx.EvmC.Operation == "Create" {
-			trs.To = ""
+// newTransaction converts the index-th transaction of block b. Transactions
+// sent through the gateway are reported as the ethereum transaction they were
+// sent as, others as legacy transactions built from what kortho stores, with
+// the fixed gas and price and an empty signature.
+func (s *Server) newTransaction(tx *transaction.Transaction, b *block.Block, index uint64) *Transaction {
+	trs := &Transaction{
+		BlockHash:        common.BytesToHash(b.Hash),
+		BlockNumber:      hexutil.Uint64(b.Height),
+		From:             tx.EthFrom,
+		Gas:              hexutil.Uint64(GASPRICE),
+		GasPrice:         (*hexutil.Big)(s.units.effectiveGasPrice(nil)),
+		Hash:             s.ethTxHash(tx.Hash),
+		Input:            hexutil.Bytes{},
+		Nonce:            hexutil.Uint64(tx.Nonce),
+		TransactionIndex: hexutil.Uint64(index),
+		Value:            s.units.uint64ToWei(tx.Amount),
+		Type:             types.LegacyTxType,
+		V:                (*hexutil.Big)(new(big.Int)),
+		R:                (*hexutil.Big)(new(big.Int)),
+		S:                (*hexutil.Big)(new(big.Int)),
+	}
+	if !isContractCreation(tx) {
+		to := tx.EthTo
+		trs.To = &to
+	}
+
+	ethTx := s.ethTx(tx)
+	if ethTx == nil {
+		return trs
+	}
+	v, r, sig := ethTx.RawSignatureValues()
+	trs.Gas = hexutil.Uint64(ethTx.Gas())
+	trs.GasPrice = (*hexutil.Big)(s.units.effectiveGasPrice(ethTx))
+	trs.Input = ethTx.Data()
+	trs.Nonce = hexutil.Uint64(ethTx.Nonce())
+	trs.Value = (*hexutil.Big)(ethTx.Value())
+	trs.Type = hexutil.Uint64(ethTx.Type())
+	trs.V, trs.R, trs.S = (*hexutil.Big)(v), (*hexutil.Big)(r), (*hexutil.Big)(sig)
+
+	switch ethTx.Type() {
+	case types.LegacyTxType:
+		if ethTx.Protected() {
+			trs.ChainID = (*hexutil.Big)(ethTx.ChainId())
 		}
-	}
-	return &trs, nil
+	case types.DynamicFeeTxType:
+		trs.GasFeeCap = (*hexutil.Big)(ethTx.GasFeeCap())
+		trs.GasTipCap = (*hexutil.Big)(ethTx.GasTipCap())
+		fallthrough
+	case types.AccessListTxType:
+		al := ethTx.AccessList()
+		trs.Accesses = &al
+		trs.ChainID = (*hexutil.Big)(ethTx.ChainId())
+	}
+	return trs
 }
 
-func (s *Server) eth_getCode(addr string) (string, error) {
+func (s *Server) eth_getCode(addr string, blockNr *BlockNumberOrHash) (string, error) {
 	log.Println("GetCode=", addr)
+	if err := s.stateBlock(blockNr); err != nil {
+		return "", err
+	}
 	return s.cli.GetCode(addr)
 }
 
-func (s *Server) eth_getTransactionCount(addr string) (uint64, error) {
+func (s *Server) eth_getTransactionCount(addr string, blockNr *BlockNumberOrHash) (hexutil.Uint64, error) {
 	log.Println("eth_getTransactionCount addr=", addr)
-	return s.cli.GetNonce(addr)
+	if err := s.stateBlock(blockNr); err != nil {
+		return 0, err
+	}
+	n, err := s.cli.GetNonce(addr)
+	return hexutil.Uint64(n), err
 }
 
-func (s *Server) eth_gasPrice() (string, error) {
-	return "0x" + fmt.Sprintf("%X", 21000), nil
+func (s *Server) eth_gasPrice() (*hexutil.Big, error) {
+	return (*hexutil.Big)(s.units.minGasPrice()), nil
 }
 
-func (s *Server) eth_estimateGas(mp map[string]interface{}) (string, error) {
-	log.Println("eth_estimateGas:", mp)
-	v, ok := mp["params"]
-	if !ok {
-		return "", errors.New(fmt.Sprintf("'%s' not exist", "params"))
-	}
-
-	if _, ok := v.([]interface{}); !ok {
-		return "", errors.New("eth_estimateGas: params is wrong!")
-	}
-
-	Para := v.([]interface{})
-	var para params
-
-	err := mapstructure.Decode(Para[0].(map[string]interface{}), &para)
-	if err != nil {
-		return "", err
-	}
+func (s *Server) eth_estimateGas(para params, blockNr *BlockNumberOrHash) (hexutil.Uint64, error) {
 	log.Printf("eth_estimateGas params: from=%v,to=%v,gas=%v,gasPrice=%v,value=%v,data=%v\n", para.From, para.To, para.Gas, para.GasPrice, para.Value, para.Data)
-
-	if len(para.To) <= 0 {
-		return fmt.Sprintf("%X", GASPRICE), nil
-	}
-
-	ret, err := s.cli.ContractCall(para.From, para.To, para.Data) //para.From, para.To, PRI, para.Value, "call")
-
-	if err == nil {
-		return fmt.Sprintf("%X", GASPRICE), nil
+	env, err := s.newCallEnv(blockNr, true)
+	if err != nil {
+		return 0, err
 	}
-
-	log.Println("eth_estimateGas successfully,ret:", ret)
-	return ret, err
+	gas, err := s.estimateGas(env, para)
+	return hexutil.Uint64(gas), err
 }
 
+// eth_getTransactionReceipt returns null for unknown transactions and ones
+// not yet in a block.
 func (s *Server) eth_getTransactionReceipt(hash string) (*TransactionReceipt, error) {
-	if len(hash) > 0 {
-		if hash[:2] == "0x" {
-			hash = hash[2:]
-		}
-	}
+	hash = s.korthoTxHash(hash)
 	log.Println("eth_getTransactionReceipt hash=", hash)
 	tx, err := s.cli.GetTransactionByHash(hash)
 	if err != nil {
-		return nil, errors.New(err.Error())
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
 	}
 
 	b, err := s.cli.GetBlockByNumber(tx.BlockNumber)
 	if err != nil {
-		return nil, errors.New(err.Error())
-	}
-
-	var trp TransactionReceipt
-	trp.TransactionHash = common.BytesToHash(tx.Hash)
-	trp.BlockNumber = tx.BlockNumber
-	trp.GasUsed = GASPRICE
-	trp.CumulativeGasUsed = trp.GasUsed
-	trp.BlockHash = common.BytesToHash(b.Hash)
-	trp.From = tx.EthFrom
-	trp.To = tx.EthTo
-
-	var txIndex uint
-	if tx.EvmC != nil { //contract tx
-		trp.ContractAddress = tx.EvmC.ContractAddr
-		if tx.EvmC.Operation == "create" || tx.EvmC.Operation == "Create" {
-			trp.To = common.Address{}
+		if isNotFound(err) {
+			return nil, nil
 		}
-
-		if !tx.EvmC.Status {
-			trp.Status = 0
-		} else {
-			trp.Status = 1
+		return nil, err
+	}
+	index := -1
+	for i, btx := range b.Transactions {
+		if bytes.Equal(btx.Hash, tx.Hash) {
+			index = i
+			break
 		}
+	}
+	if index < 0 {
+		return nil, nil
+	}
+
+	receipt := s.blockReceipts(b)[index]
+	trp := &TransactionReceipt{
+		BlockHash:         receipt.BlockHash,
+		BlockNumber:       hexutil.Uint64(b.Height),
+		CumulativeGasUsed: hexutil.Uint64(receipt.CumulativeGasUsed),
+		EffectiveGasPrice: (*hexutil.Big)(s.units.effectiveGasPrice(nil)),
+		From:              tx.EthFrom,
+		GasUsed:           hexutil.Uint64(receipt.GasUsed),
+		Logs:              receipt.Logs,
+		LogsBloom:         receipt.Bloom,
+		Status:            hexutil.Uint64(receipt.Status),
+		TransactionHash:   receipt.TxHash,
+		TransactionIndex:  hexutil.Uint64(index),
+		Type:              types.LegacyTxType,
+	}
+	if trp.Logs == nil {
+		trp.Logs = []*types.Log{}
+	}
+	if ethTx := s.ethTx(tx); ethTx != nil {
+		trp.Type = hexutil.Uint64(ethTx.Type())
+		trp.EffectiveGasPrice = (*hexutil.Big)(s.units.effectiveGasPrice(ethTx))
+	}
+	if isContractCreation(tx) {
+		trp.ContractAddress = &receipt.ContractAddress
+	} else {
+		trp.To = &tx.EthTo
+	}
+
+	log.Println("success to eth_getTransactionReceipt txhash,contractAddr,blockhash,blocknumber:", trp.TransactionHash, receipt.ContractAddress, trp.BlockHash, trp.BlockNumber)
+	return trp, nil
+}
 
-		log.Println("eth_getTransactionReceipt GetLogs hash:", hex.EncodeToString(tx.Hash), "trp.Root:", trp.Root)
+// eth_getLogs returns the logs matching para, of the block para.BlockHash or
+// of the range fromBlock to toBlock, both "latest" when missing. Ranges wider
+// than logsMaxRange and more than logsMaxResults logs are refused.
+func (s *Server) eth_getLogs(para reqGetLog) ([]*types.Log, error) {
+	log.Printf("eth_getLogs params: blockHash = %v,fromBlock=%v,toBlock=%v,address=%v,topics=%v\n", para.BlockHash, para.FromBlock, para.ToBlock, para.Addresses, para.Topics)
 
-		logs, err := s.cli.GetLogs(hex.EncodeToString(tx.Hash))
+	if para.BlockHash != "" {
+		logs, err := s.getLogs(para, 0, 0, strip0x(para.BlockHash))
 		if err != nil {
-			log.Println("GetLogs error:", err)
-		}
-		for i, lo := range logs {
-			var lg types.Log
-			err := json.Unmarshal([]byte(lo), &lg)
-			if err != nil {
-				log.Println("eth_getTransactionReceipt Unmarshal error:", err)
-				continue
-			}
-
-			lg.BlockNumber = tx.BlockNumber
-			trp.Logs = append(trp.Logs, &lg)
-			trp.TransactionIndex = lg.TxIndex
-			txIndex = lg.TxIndex
-			log.Printf("GetLogs[%v]:addr: %v,data: %v,topics: %v,trp.Logs length:%v\n", i, lg.Address, hex.EncodeToString(lg.Data), lg.Topics, len(trp.Logs))
+			return nil, err
 		}
-
-		//set bloom
-		receipt := &types.Receipt{
-			Type:              uint8(tx.Tag),
-			Status:            trp.Status,
-			Logs:              trp.Logs,
-			TxHash:            common.BytesToHash(tx.Hash),
-			ContractAddress:   trp.ContractAddress,
-			GasUsed:           trp.GasUsed,
-			BlockHash:         common.BytesToHash(b.Hash),
-			TransactionIndex:  txIndex,
-			BlockNumber:       new(big.Int).SetUint64(tx.BlockNumber),
-			PostState:         trp.Root.Bytes(),
-			CumulativeGasUsed: trp.GasUsed,
+		if len(logs) > s.logsMaxResults {
+			return nil, s.tooManyLogs()
 		}
-		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
-
-		trp.LogsBloom = receipt.Bloom //types.Bloom{} //or receipt.Bloom,if use bloom it will filter corresponding log
-	} else { //kto tx
-		trp.Status = 1
+		return logs, nil
 	}
 
-	log.Println("success to eth_getTransactionReceipt txhash,contractAddr,blockhash,blocknumber:", trp.TransactionHash, trp.ContractAddress, trp.BlockHash, trp.BlockNumber)
-	return &trp, nil
-}
-
-func (s *Server) eth_getLogs(mp map[string]interface{}) ([]*types.Log, error) {
-	log.Println("eth_getLogs:", mp)
-	v, ok := mp["params"]
-	if !ok {
-		return nil, errors.New(fmt.Sprintf("'%s' not exist", "params"))
+	fromBlock, toBlock, err := s.logsRange(para)
+	if err != nil {
+		return nil, err
 	}
-
-	if _, ok := v.([]interface{}); !ok {
-		return nil, errors.New("eth_call: params is wrong!")
+	if fromBlock > toBlock { //the range starts past the head
+		return []*types.Log{}, nil
 	}
+	if span := toBlock - fromBlock + 1; span > s.logsMaxRange {
+		return nil, newRPCError(ErrCodeLimitExceeded, "query exceeds max block range %d: %d blocks requested", s.logsMaxRange, span)
+	}
+	return s.queryLogs(para, fromBlock, toBlock)
+}
 
-	Para := v.([]interface{})
-	var para reqGetLog
-
-	err := mapstructure.Decode(Para[0].(map[string]interface{}), &para)
+// logsRange resolves the block range of a log filter, tags and missing
+// bounds are the head. A toBlock past the head is cut back to the head.
+func (s *Server) logsRange(para reqGetLog) (uint64, uint64, error) {
+	head, err := s.cli.GetBlockNumber()
 	if err != nil {
-		return nil, err
+		return 0, 0, err
 	}
-	log.Printf("eth_getLogs params: blockHash = %v,fromBlock=%v,toBlock=%v,address=%v,topics=%v\n", para.BlockHash, para.FromBlock, para.ToBlock, para.Address, para.Topics)
-
-	var resLogs []*types.Log
-	var fromBlock, toBlock uint64
-
-	if len(para.FromBlock) > 0 && len(para.ToBlock) > 0 {
-		fb, err := strconv.ParseUint(para.FromBlock[2:], 16, 64)
-		if err != nil {
-			fmt.Println("fromblock ParseUint error:", err)
-			return nil, err
+	resolve := func(bn *BlockNumber) uint64 {
+		if bn == nil || bn.isTag() {
+			return head
 		}
+		return uint64(*bn)
+	}
 
-		fromBlock = fb
+	fromBlock, toBlock := resolve(para.FromBlock), resolve(para.ToBlock)
+	if fromBlock > toBlock {
+		return 0, 0, invalidParams("invalid block range: fromBlock %v is after toBlock %v", fromBlock, toBlock)
+	}
+	if toBlock > head {
+		toBlock = head
+	}
+	return fromBlock, toBlock, nil
+}
 
-		tb, err := strconv.ParseUint(para.ToBlock[2:], 16, 64)
+// queryLogs fetches the logs of a block range matching crit, asking the node
+// for logsChunkSize blocks at a time so long scans don't time out. It stops
+// as soon as more than logsMaxResults logs are found.
+func (s *Server) queryLogs(crit reqGetLog, fromBlock, toBlock uint64) ([]*types.Log, error) {
+	logs := []*types.Log{}
+	for from := fromBlock; ; from += s.logsChunkSize {
+		to := toBlock
+		if toBlock-from >= s.logsChunkSize {
+			to = from + s.logsChunkSize - 1
+		}
+		chunk, err := s.getLogs(crit, from, to, "")
 		if err != nil {
-			fmt.Println("toblock ParseUint error:", err)
 			return nil, err
 		}
-		toBlock = tb
+		if logs = append(logs, chunk...); len(logs) > s.logsMaxResults {
+			return nil, s.tooManyLogs()
+		}
+		if to == toBlock {
+			return logs, nil
+		}
 	}
+}
+
+func (s *Server) tooManyLogs() error {
+	return newRPCError(ErrCodeLimitExceeded, "query returned more than %d results", s.logsMaxResults)
+}
 
-	logs, err := s.cli.Logs(para.Address, fromBlock, toBlock, para.Topics, para.BlockHash)
+// getLogs fetches the logs of a block range or block hash matching crit
+// from the kortho node. The node filters by a single address at most and not
+// by topics, so the logs are filtered again here.
+func (s *Server) getLogs(crit reqGetLog, fromBlock, toBlock uint64, blockHash string) ([]*types.Log, error) {
+	var address string
+	if len(crit.Addresses) == 1 {
+		address = crit.Addresses[0].Hex()
+	}
+	logs, err := s.cli.Logs(address, fromBlock, toBlock, nil, blockHash)
 	if err != nil {
 		log.Println("GetLogs error:", err)
+		return nil, err
 	}
+
+	resLogs := []*types.Log{}
 	for i, lo := range logs {
 		var lg types.Log
 		err := json.Unmarshal([]byte(lo), &lg)
 		if err != nil {
-			log.Println("eth_getTransactionReceipt Unmarshal error:", err)
+			log.Println("getLogs Unmarshal error:", err)
 			continue
 		}
 
+		if !crit.matches(&lg) {
+			continue
+		}
+		lg.TxHash = s.ethTxHash(lg.TxHash[:])
 		resLogs = append(resLogs, &lg)
 		log.Printf("GetLogs[%v]:addr: %v,data: %v,topics: %v, txHash:%v\n", i, lg.Address, hex.EncodeToString(lg.Data), lg.Topics, lg.TxHash)
 	}
-
-	// var reslog resGetLogs
-	// if para.FromBlock == para.ToBlock {
-	// 	reslog.BlockNumber = para.FromBlock
-	// }
-
-	// if para.FromBlock != "" {
-	// 	num, err := strconv.ParseUint(para.FromBlock[2:], 16, 64)
-	// 	if err != nil {
-	// 		fmt.Println("ParseUint error:", err)
-	// 		return nil, err
-	// 	}
-
-	// 	b, err := s.cli.GetBlockByNumber(num)
-	// 	if err != nil {
-	// 		log.Println("GetBlockByNumber error==========:", err)
-	// 		return nil, errors.New(err.Error())
-	// 	}
-
-	// 	reslog.BlockHash = hex.EncodeToString(b.Hash)
-	// 	reslog.Address = para.Address
-	// }
-
-	log.Println("eth_getLogs successfully,reslog:", resLogs)
 	return resLogs, nil
 }
 
-func (s *Server) web3_clientVersion() string {
-	return "Mist/v0.9.3/darwin/go1.16"
+func (s *Server) web3_clientVersion() (string, error) {
+	return "Mist/v0.9.3/darwin/go1.16", nil
 }
-func (s *Server) eth_getStorageAt(mp map[string]interface{}) (string, error) {
-	log.Println("eth_getStorageAt:", mp)
-	v, ok := mp["params"]
-	if !ok {
-		return "", errors.New(fmt.Sprintf("'%s' not exist", "params"))
-	}
 
-	var addr, hash string
-	if paras, ok := v.([]interface{}); ok {
-		addr = paras[0].(string)
-		hash = paras[1].(string)
-	} else {
-		return "", errors.New("eth_getStorageAt: params is wrong!")
+func (s *Server) eth_getStorageAt(addr, hash string, blockNr *BlockNumberOrHash) (string, error) {
+	log.Println("eth_getStorageAt:", addr, hash)
+	if err := s.stateBlock(blockNr); err != nil {
+		return "", err
 	}
 	return s.cli.GetStorageAt(addr, hash)
 }
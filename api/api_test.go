@@ -0,0 +1,1165 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"kortho/block"
+	"kortho/transaction"
+	"math"
+	"math/big"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const fakeKorthoHash = "00000000000000000000000000000000000000000000000000000000000000aa"
+
+const (
+	revertingContract = "0x00000000000000000000000000000000000000ff"
+	// Error("nope")
+	revertReason = "08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000004" +
+		"6e6f706500000000000000000000000000000000000000000000000000000000"
+
+	storageContract = "0x00000000000000000000000000000000000000aa"
+	numberContract  = "0x00000000000000000000000000000000000000bb"
+)
+
+// fakeCode is the code the fake node reports, storageContract returns its
+// slot 0 and numberContract the block number.
+var fakeCode = map[string]string{
+	storageContract: "0x60005460005260206000f3",
+	numberContract:  "0x4360005260206000f3",
+	// copies revertReason from behind the code and reverts with it
+	revertingContract: "0x6064600c60003960646000fd" + revertReason,
+}
+
+// fakeTx is the second transaction of block 3, pendingKorthoHash is known to
+// the node but in no block.
+var fakeTx = &transaction.Transaction{
+	Hash:        common.FromHex(fakeKorthoHash),
+	BlockNumber: 3,
+	EthFrom:     common.HexToAddress("0x01"),
+	EthTo:       common.HexToAddress("0x02"),
+	EvmC:        &transaction.EvmContract{Operation: "Create", ContractAddr: common.HexToAddress("0x03"), Status: true},
+}
+
+// testGasPrice is MINGASPRICE in wei at the default decimals.
+var testGasPrice = newUnits(defaultDecimals).minGasPrice()
+
+const pendingKorthoHash = "0x0505050505050505050505050505050505050505050505050505050505050505"
+
+type fakeClient struct {
+	height uint64
+	logs   []string //answered to every Logs request
+
+	logRanges [][2]uint64 //block ranges of the Logs requests
+	sent      []string    //raw transactions in the order they were sent
+}
+
+func (c *fakeClient) setHeight(h uint64) { atomic.StoreUint64(&c.height, h) }
+
+func (c *fakeClient) SendTransaction(from, to, priv string, amount *big.Int) (string, error) {
+	return "", errors.New("not implemented")
+}
+func (c *fakeClient) ContractCreate(createCode string, origin string) (string, error) {
+	return "", errors.New("not implemented")
+}
+func (c *fakeClient) ContractCall(origin string, contractAddr string, callInput string) (string, error) {
+	if contractAddr == revertingContract {
+		return revertReason, vm.ErrExecutionReverted
+	}
+	return "", nil
+}
+func (c *fakeClient) GetBlockNumber() (uint64, error)          { return atomic.LoadUint64(&c.height), nil }
+func (c *fakeClient) GetBalance(from string) (*big.Int, error) { return big.NewInt(1), nil }
+func (c *fakeClient) GetBlockByHash(hash string) (*block.Block, error) {
+	return nil, status.Errorf(codes.NotFound, "GetBlockByHash error: %v,Code = 1,%v", hash, korthoNotExist)
+}
+func (c *fakeClient) GetBlockByNumber(num uint64) (*block.Block, error) {
+	b := &block.Block{Height: num, Hash: []byte{1}, PrevHash: []byte{0}}
+	if num == fakeTx.BlockNumber {
+		b.Transactions = []*transaction.Transaction{{Hash: []byte{2}}, fakeTx}
+	}
+	return b, nil
+}
+func (c *fakeClient) GetCode(contractAddr string) (string, error) {
+	return "0x" + strip0x(fakeCode[strings.ToLower(contractAddr)]), nil
+}
+func (c *fakeClient) GetNonce(addr string) (uint64, error) { return 0, nil }
+func (c *fakeClient) GetTransactionByHash(hash string) (*transaction.Transaction, error) {
+	if hash == fakeKorthoHash {
+		return fakeTx, nil
+	}
+	if hash == strip0x(pendingKorthoHash) {
+		return &transaction.Transaction{Hash: common.FromHex(pendingKorthoHash), BlockNumber: fakeTx.BlockNumber}, nil
+	}
+	return nil, status.Errorf(codes.NotFound, "GetTransactionByHash error: %v,Code = 1,%v", hash, korthoNotExist)
+}
+func (c *fakeClient) SendRawTransaction(rawTx string) (string, error) {
+	c.sent = append(c.sent, rawTx)
+	return fakeKorthoHash, nil
+}
+func (c *fakeClient) GetTransactionReceipt(hash string) (*transaction.Transaction, error) {
+	return c.GetTransactionByHash(hash)
+}
+func (c *fakeClient) GetLogs(hash string) ([]string, error) { return nil, nil }
+func (c *fakeClient) GetStorageAt(addr, hash string) (string, error) {
+	if strings.EqualFold(addr, storageContract) && common.HexToHash(hash) == (common.Hash{}) {
+		return "0x2a", nil
+	}
+	return "0x", nil
+}
+func (c *fakeClient) Logs(address string, fromB, toB uint64, topics []string, blockH string) ([]string, error) {
+	c.logRanges = append(c.logRanges, [2]uint64{fromB, toB})
+	return c.logs, nil
+}
+
+func newTestServer() *Server {
+	return newServer(&fakeClient{height: 16}, &Config{ChainId: "0x1", NetworkId: "1", BatchLimit: 3})
+}
+
+func doRequest(s *Server, body string) string {
+	w := httptest.NewRecorder()
+	s.HandRequest(w, httptest.NewRequest("POST", "/", strings.NewReader(body)))
+	res, _ := ioutil.ReadAll(w.Result().Body)
+	return string(res)
+}
+
+func TestBatchRequest(t *testing.T) {
+	s := newTestServer()
+	res := doRequest(s, `[
+		{"jsonrpc":"2.0","id":1,"method":"eth_chainId","params":[]},
+		{"jsonrpc":"2.0","method":"eth_blockNumber","params":[]},
+		{"jsonrpc":"2.0","id":"b","method":"eth_blockNumber","params":[]}
+	]`)
+
+	var resps []map[string]interface{}
+	if err := json.Unmarshal([]byte(res), &resps); err != nil {
+		t.Fatalf("response is not an array: %v, %s", err, res)
+	}
+	if len(resps) != 2 {
+		t.Fatalf("expected 2 responses, got %v: %s", len(resps), res)
+	}
+	if resps[0]["id"] != float64(1) || resps[0]["result"] != "0x1" {
+		t.Errorf("unexpected first response: %v", resps[0])
+	}
+	if resps[1]["id"] != "b" || resps[1]["result"] != "0x10" {
+		t.Errorf("unexpected second response: %v", resps[1])
+	}
+}
+
+func TestBatchOrder(t *testing.T) {
+	cli := &fakeClient{height: 16}
+	s := newServer(cli, &Config{ChainId: "0x1"})
+	key, _ := crypto.GenerateKey()
+	var reqs, want []string
+	for nonce := uint64(0); nonce < 8; nonce++ {
+		tx := types.MustSignNewTx(key, types.NewEIP155Signer(big.NewInt(1)), &types.LegacyTx{Nonce: nonce, Gas: 21000, GasPrice: testGasPrice})
+		raw, _ := tx.MarshalBinary()
+		want = append(want, hexutil.Encode(raw))
+		reqs = append(reqs, `{"jsonrpc":"2.0","id":`+fmt.Sprint(nonce)+`,"method":"eth_sendRawTransaction","params":["`+hexutil.Encode(raw)+`"]}`)
+	}
+	doRequest(s, "["+strings.Join(reqs, ",")+"]")
+	if fmt.Sprint(cli.sent) != fmt.Sprint(want) {
+		t.Errorf("transactions sent out of order")
+	}
+}
+
+func TestBatchLimit(t *testing.T) {
+	s := newTestServer()
+	req := `{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}`
+	res := doRequest(s, "["+strings.Repeat(req+",", 3)+req+"]")
+
+	var resp responseErr
+	if err := json.Unmarshal([]byte(res), &resp); err != nil || resp.Error == nil {
+		t.Fatalf("expected error response, got %s", res)
+	}
+	if resp.Error.Code != -32600 {
+		t.Errorf("expected code -32600, got %v", resp.Error.Code)
+	}
+}
+
+func TestEmptyBatch(t *testing.T) {
+	res := doRequest(newTestServer(), `[]`)
+	if !strings.Contains(res, "-32600") {
+		t.Errorf("expected invalid request error, got %s", res)
+	}
+}
+
+func TestNotificationOnly(t *testing.T) {
+	res := doRequest(newTestServer(), `[{"jsonrpc":"2.0","method":"eth_chainId"}]`)
+	if res != "" {
+		t.Errorf("expected empty response, got %s", res)
+	}
+}
+
+func TestErrorResponses(t *testing.T) {
+	s := newTestServer()
+	tests := []struct {
+		body string
+		id   interface{}
+		code int
+	}{
+		{`{"jsonrpc":"2.0","id":7,"method":"eth_foo","params":[]}`, float64(7), ErrCodeMethodNotFound},
+		{`{"jsonrpc":"2.0","id":"x","method":"eth_getBalance","params":[]}`, "x", ErrCodeInvalidParams},
+		{`{"jsonrpc":"1.0","id":3,"method":"eth_chainId"}`, float64(3), ErrCodeInvalidRequest},
+		{`{"jsonrpc":"2.0","id":3,"method"`, nil, ErrCodeParse},
+	}
+	for _, tt := range tests {
+		var resp responseErr
+		res := doRequest(s, tt.body)
+		if err := json.Unmarshal([]byte(res), &resp); err != nil || resp.Error == nil {
+			t.Errorf("%s: expected error response, got %s", tt.body, res)
+			continue
+		}
+		if resp.Error.Code != tt.code || resp.Id != tt.id {
+			t.Errorf("%s: got code %v id %v, want code %v id %v", tt.body, resp.Error.Code, resp.Id, tt.code, tt.id)
+		}
+	}
+}
+
+func TestGrpcErrorMapping(t *testing.T) {
+	if !isNotExist(status.Error(codes.Unknown, "NotExist")) {
+		t.Error("NotExist status not recognized")
+	}
+	if e := toErrorBody(status.Error(codes.InvalidArgument, "bad address")); e.Code != ErrCodeInvalidParams {
+		t.Errorf("InvalidArgument mapped to %v", e.Code)
+	}
+	if e := toErrorBody(errors.New("boom")); e.Code != ErrCodeServer || e.Message != "boom" {
+		t.Errorf("plain error mapped to %v %v", e.Code, e.Message)
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	s := newServer(&fakeClient{}, &Config{ChainId: "0x1", Namespaces: []string{"net"}})
+	res := doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}`)
+	if !strings.Contains(res, "-32601") {
+		t.Errorf("eth namespace should be disabled, got %s", res)
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	r := newRegistry(nil)
+	r.register("eth_test", func(a string, b *bool) (string, error) {
+		if b != nil && *b {
+			return a + "!", nil
+		}
+		return a, nil
+	})
+	m, _ := r.lookup("eth_test")
+
+	tests := []struct {
+		params string
+		res    interface{}
+		fail   bool
+	}{
+		{`["x"]`, "x", false},
+		{`["x", true]`, "x!", false},
+		{`["x", null]`, "x", false},
+		{`[]`, nil, true},
+		{`["x", true, 1]`, nil, true},
+		{`{"a":"x"}`, nil, true},
+		{`[1]`, nil, true},
+	}
+	for _, tt := range tests {
+		res, err := m.call(context.Background(), json.RawMessage(tt.params))
+		if (err != nil) != tt.fail {
+			t.Errorf("%s: unexpected error %v", tt.params, err)
+			continue
+		}
+		if err != nil {
+			if e := toErrorBody(err); e.Code != ErrCodeInvalidParams {
+				t.Errorf("%s: got code %v", tt.params, e.Code)
+			}
+			continue
+		}
+		if res != tt.res {
+			t.Errorf("%s: got %v, want %v", tt.params, res, tt.res)
+		}
+	}
+}
+
+func TestBlockFilter(t *testing.T) {
+	cli := &fakeClient{height: 10}
+	s := newServer(cli, &Config{MaxFilters: 2})
+
+	var id responseBody
+	json.Unmarshal([]byte(doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_newBlockFilter"}`)), &id)
+	if id.Result == nil {
+		t.Fatal("eth_newBlockFilter failed")
+	}
+	cli.setHeight(12)
+
+	var changes struct {
+		Result []string `json:"result"`
+	}
+	req := `{"jsonrpc":"2.0","id":2,"method":"eth_getFilterChanges","params":["` + id.Result.(string) + `"]}`
+	json.Unmarshal([]byte(doRequest(s, req)), &changes)
+	if len(changes.Result) != 2 {
+		t.Errorf("expected 2 block hashes, got %v", changes.Result)
+	}
+	json.Unmarshal([]byte(doRequest(s, req)), &changes)
+	if len(changes.Result) != 0 {
+		t.Errorf("expected no changes, got %v", changes.Result)
+	}
+
+	doRequest(s, `{"jsonrpc":"2.0","id":3,"method":"eth_newPendingTransactionFilter"}`)
+	res := doRequest(s, `{"jsonrpc":"2.0","id":4,"method":"eth_newBlockFilter"}`)
+	if !strings.Contains(res, "too many filters") {
+		t.Errorf("expected filter limit error, got %s", res)
+	}
+
+	doRequest(s, `{"jsonrpc":"2.0","id":5,"method":"eth_uninstallFilter","params":["`+id.Result.(string)+`"]}`)
+	if res := doRequest(s, req); !strings.Contains(res, "filter not found") {
+		t.Errorf("expected filter not found, got %s", res)
+	}
+}
+
+func TestFilterOwner(t *testing.T) {
+	s := newServer(&fakeClient{height: 10}, &Config{TrustedProxies: []string{"192.0.2.1", "10.0.0.1"}})
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set("X-Forwarded-For", "203.0.113.9, 198.51.100.7, 10.0.0.1")
+	if addr := s.clientAddr(req); addr != "198.51.100.7" {
+		t.Errorf("behind trusted proxies: got %v", addr)
+	}
+	req.RemoteAddr = "198.51.100.8:1234"
+	if addr := s.clientAddr(req); addr != "198.51.100.8" {
+		t.Errorf("untrusted X-Forwarded-For: got %v", addr)
+	}
+
+	s = newServer(&fakeClient{height: 10}, &Config{MaxFilters: 2, MaxFiltersTotal: 3})
+	for i := 0; i < 4; i++ {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"eth_newBlockFilter"}`))
+		req.RemoteAddr = fmt.Sprintf("198.51.100.%d:1234", i)
+		req.Header.Set("X-Forwarded-For", "203.0.113.9")
+		w := httptest.NewRecorder()
+		s.HandRequest(w, req)
+		if res := w.Body.String(); (i < 3) != strings.Contains(res, `"result"`) {
+			t.Errorf("filter %d: got %s", i, res)
+		}
+	}
+}
+
+func TestBlockNumberOrHash(t *testing.T) {
+	tests := []struct {
+		input string
+		num   BlockNumber
+		hash  bool
+		fail  bool
+	}{
+		{`"latest"`, LatestBlockNumber, false, false},
+		{`"earliest"`, EarliestBlockNumber, false, false},
+		{`"pending"`, PendingBlockNumber, false, false},
+		{`"safe"`, SafeBlockNumber, false, false},
+		{`"finalized"`, FinalizedBlockNumber, false, false},
+		{`"0x1f"`, 31, false, false},
+		{`{"blockNumber":"0x2"}`, 2, false, false},
+		{`"0x0000000000000000000000000000000000000000000000000000000000000001"`, 0, true, false},
+		{`{"blockHash":"0x0000000000000000000000000000000000000000000000000000000000000001"}`, 0, true, false},
+		{`"0x"`, 0, false, true},
+		{`"1"`, 0, false, true},
+		{`{}`, 0, false, true},
+	}
+	for _, tt := range tests {
+		var bnh BlockNumberOrHash
+		err := json.Unmarshal([]byte(tt.input), &bnh)
+		if (err != nil) != tt.fail {
+			t.Errorf("%s: unexpected error %v", tt.input, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if tt.hash != (bnh.BlockHash != nil) {
+			t.Errorf("%s: hash form mismatch", tt.input)
+		}
+		if !tt.hash && *bnh.BlockNumber != tt.num {
+			t.Errorf("%s: got %v, want %v", tt.input, *bnh.BlockNumber, tt.num)
+		}
+	}
+}
+
+func TestGetBlockByNumberTags(t *testing.T) {
+	s := newTestServer()
+	if res := doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_getBlockByNumber","params":["latest",false]}`); !strings.Contains(res, `"number":"0x10"`) {
+		t.Errorf("latest should resolve to the head, got %s", res)
+	}
+	if res := doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_getBlockByNumber","params":["0x11",false]}`); !strings.Contains(res, `"result":null`) {
+		t.Errorf("future block should be null, got %s", res)
+	}
+	if res := doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_getBlockByNumber","params":["0",false]}`); !strings.Contains(res, "-32602") {
+		t.Errorf("expected invalid params, got %s", res)
+	}
+	if res := doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_getBalance","params":["0x01","0x20"]}`); !strings.Contains(res, "header not found") {
+		t.Errorf("expected header not found, got %s", res)
+	}
+}
+
+func TestNewBlock(t *testing.T) {
+	s := newTestServer()
+	b := &block.Block{
+		Height:   5,
+		Hash:     []byte{5},
+		PrevHash: []byte{4},
+		Transactions: []*transaction.Transaction{
+			{Hash: []byte{0xa1}, BlockNumber: 5},
+			{Hash: []byte{0xa2}, BlockNumber: 5},
+		},
+	}
+
+	blk := s.newBlock(b, false)
+	if len(blk.Transactions) != 2 || blk.Transactions[0] != common.BytesToHash([]byte{0xa1}) {
+		t.Fatalf("unexpected transactions %v", blk.Transactions)
+	}
+	if blk.TransactionsRoot == types.EmptyRootHash || blk.ReceiptsRoot == types.EmptyRootHash {
+		t.Error("roots of a non-empty block should not be empty")
+	}
+	if uint64(blk.GasUsed) != 2*GASPRICE || blk.Size == 0 {
+		t.Errorf("unexpected gasUsed %v size %v", blk.GasUsed, blk.Size)
+	}
+
+	full := s.newBlock(b, true)
+	tx, ok := full.Transactions[1].(*Transaction)
+	if !ok || tx.TransactionIndex != 1 || tx.BlockHash != common.BytesToHash([]byte{5}) {
+		t.Fatalf("unexpected full transaction %+v", full.Transactions[1])
+	}
+
+	empty := s.newBlock(&block.Block{Height: 6}, false)
+	enc, _ := json.Marshal(empty)
+	for _, want := range []string{`"transactions":[]`, `"uncles":[]`, `"transactionsRoot":"` + types.EmptyRootHash.Hex()} {
+		if !strings.Contains(string(enc), want) {
+			t.Errorf("missing %s in %s", want, enc)
+		}
+	}
+}
+
+func TestRawTxHashIndex(t *testing.T) {
+	s := newTestServer()
+	key, _ := crypto.GenerateKey()
+	tx := types.MustSignNewTx(key, types.NewLondonSigner(big.NewInt(1)), &types.DynamicFeeTx{ChainID: big.NewInt(1), Gas: 21000, GasFeeCap: testGasPrice})
+	raw, _ := tx.MarshalBinary()
+	ethHash := tx.Hash().Hex()
+	if res := doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_sendRawTransaction","params":["`+hexutil.Encode(raw)+`"]}`); !strings.Contains(res, ethHash) {
+		t.Fatalf("expected the ethereum hash %v, got %s", ethHash, res)
+	}
+
+	for _, hash := range []string{ethHash, "0x" + fakeKorthoHash} {
+		res := doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_getTransactionByHash","params":["`+hash+`"]}`)
+		if !strings.Contains(res, `"hash":"`+ethHash+`"`) {
+			t.Errorf("lookup by %v: got %s", hash, res)
+		}
+	}
+	if res := doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_sendRawTransaction","params":["0xzz"]}`); !strings.Contains(res, "-32602") {
+		t.Errorf("expected invalid params, got %s", res)
+	}
+}
+
+func TestTxHashIndexPersists(t *testing.T) {
+	dir := t.TempDir()
+	ix, err := newTxHashIndex(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ethHash := common.HexToHash("0x07")
+	if err := ix.put(ethHash, []byte{8}, []byte{9}); err != nil {
+		t.Fatal(err)
+	}
+	ix.db.Close()
+
+	if ix, err = newTxHashIndex(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer ix.db.Close()
+	if kh, ok := ix.korthoHash(ethHash); !ok || !bytes.Equal(kh, []byte{8}) {
+		t.Errorf("expected the mapping to survive a reopen, got %x %v", kh, ok)
+	}
+}
+
+func TestHandlerPanic(t *testing.T) {
+	s := newTestServer()
+	s.methods.register("eth_crash", func() (string, error) {
+		var b []byte
+		return string(b[64:68]), nil
+	})
+	res := doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_crash"}`)
+	if !strings.Contains(res, "-32603") {
+		t.Errorf("expected internal error, got %s", res)
+	}
+	if res := doRequest(s, `{"jsonrpc":"2.0","id":2,"method":"eth_chainId"}`); !strings.Contains(res, `"result":"0x1"`) {
+		t.Errorf("server should keep serving after a panic, got %s", res)
+	}
+}
+
+func TestCallError(t *testing.T) {
+	s := newTestServer()
+	for _, ret := range []string{"08c379a0", "08c379a0" + strings.Repeat("00", 20), "zz", "4e48"} {
+		err := s.callError(ret, vm.ErrExecutionReverted)
+		if body := toErrorBody(err); body.Code != ErrCodeReverted || body.Message != "execution reverted" {
+			t.Errorf("ret %q: unexpected error %+v", ret, body)
+		}
+	}
+	if body := toErrorBody(s.callError(revertReason, vm.ErrExecutionReverted)); body.Message != "execution reverted: nope" || body.Data != "0x"+revertReason {
+		t.Errorf("unexpected error %+v", body)
+	}
+	if body := toErrorBody(s.callError(revertReason, errors.New("revert of state failed"))); body.Code != ErrCodeServer || body.Data != nil {
+		t.Errorf("expected a node error mentioning revert to be passed on, got %+v", body)
+	}
+	if body := toErrorBody(s.callError("", vm.ErrExecutionReverted)); body.Code != ErrCodeReverted || body.Data != "0x" {
+		t.Errorf("expected an empty revert to have code 3, got %+v", body)
+	}
+	if body := toErrorBody(s.callError("", vm.ErrOutOfGas)); body.Code != ErrCodeServer || body.Message != "out of gas" {
+		t.Errorf("unexpected out of gas error %+v", body)
+	}
+
+	panicData := "4e487b71" + fmt.Sprintf("%064x", 0x11)
+	if body := toErrorBody(s.callError(panicData, vm.ErrExecutionReverted)); body.Message != "execution reverted: arithmetic underflow or overflow" {
+		t.Errorf("unexpected panic error %+v", body)
+	}
+	panicData = "4e487b71" + fmt.Sprintf("%064x", 0x99)
+	if body := toErrorBody(s.callError(panicData, vm.ErrExecutionReverted)); body.Message != "execution reverted: unknown panic code: 0x99" {
+		t.Errorf("unexpected panic error %+v", body)
+	}
+
+	selector := crypto.Keccak256([]byte("InsufficientBalance(uint256,uint256)"))[:4]
+	custom := fmt.Sprintf("%x%064x%064x", selector, 5, 7)
+	if body := toErrorBody(s.callError(custom, vm.ErrExecutionReverted)); body.Message != fmt.Sprintf("execution reverted: custom error %#x", selector) {
+		t.Errorf("unexpected custom error %+v", body)
+	}
+	path := filepath.Join(t.TempDir(), "errors.json")
+	ioutil.WriteFile(path, []byte(`[{"type":"error","name":"InsufficientBalance","inputs":[{"name":"available","type":"uint256"},{"name":"required","type":"uint256"}]}]`), 0600)
+	if s.errorABI, _ = loadErrorABI([]string{path}); len(s.errorABI) != 1 {
+		t.Fatal("abi not loaded")
+	}
+	if body := toErrorBody(s.callError(custom, vm.ErrExecutionReverted)); body.Message != "execution reverted: InsufficientBalance(5, 7)" {
+		t.Errorf("unexpected custom error %+v", body)
+	}
+}
+
+func TestChainIdValidation(t *testing.T) {
+	s := newTestServer()
+	key, _ := crypto.GenerateKey()
+	to := common.HexToAddress("0x60a17Ef1B8b22e89cd6d19bcCD275863d98F2091")
+	send := func(signer types.Signer) string {
+		tx := types.MustSignNewTx(key, signer, &types.LegacyTx{To: &to, Gas: 21000, GasPrice: testGasPrice})
+		raw, _ := tx.MarshalBinary()
+		return doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_sendRawTransaction","params":["`+hexutil.Encode(raw)+`"]}`)
+	}
+
+	if res := send(types.NewEIP155Signer(big.NewInt(1))); !strings.Contains(res, `"result"`) {
+		t.Errorf("expected the tx to be accepted, got %s", res)
+	}
+	if res := send(types.NewEIP155Signer(big.NewInt(5))); !strings.Contains(res, "invalid chain id") {
+		t.Errorf("expected invalid chain id, got %s", res)
+	}
+	if res := send(types.HomesteadSigner{}); !strings.Contains(res, `"result"`) {
+		t.Errorf("unprotected tx should be accepted by default, got %s", res)
+	}
+	s.rejectUnprotected = true
+	if res := send(types.HomesteadSigner{}); !strings.Contains(res, "replay-protected") {
+		t.Errorf("expected unprotected tx to be rejected, got %s", res)
+	}
+}
+
+func TestGasPrice(t *testing.T) {
+	s := newTestServer()
+	// 21000 kortho base units of 11 decimals
+	if res := doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_gasPrice"}`); !strings.Contains(res, `"result":"0x30e4f9b400"`) {
+		t.Errorf("eth_gasPrice: got %s", res)
+	}
+
+	key, _ := crypto.GenerateKey()
+	below := new(big.Int).Sub(testGasPrice, big.NewInt(1e7))
+	fraction := new(big.Int).Add(testGasPrice, big.NewInt(1))
+	for _, tt := range []struct {
+		tx   types.TxData
+		want string
+	}{
+		{&types.LegacyTx{Gas: 21000, GasPrice: testGasPrice}, `"result"`},
+		{&types.LegacyTx{Gas: 21000, GasPrice: below}, "below the minimum"},
+		{&types.LegacyTx{Gas: 21000, GasPrice: fraction}, "loses precision"},
+		{&types.DynamicFeeTx{ChainID: big.NewInt(1), Gas: 21000, GasFeeCap: below}, "below the minimum"},
+		{&types.DynamicFeeTx{ChainID: big.NewInt(1), Gas: 21000, GasFeeCap: testGasPrice, GasTipCap: big.NewInt(1)}, "loses precision"},
+	} {
+		raw, _ := types.MustSignNewTx(key, types.NewLondonSigner(big.NewInt(1)), tt.tx).MarshalBinary()
+		res := doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_sendRawTransaction","params":["`+hexutil.Encode(raw)+`"]}`)
+		if !strings.Contains(res, tt.want) {
+			t.Errorf("%T: expected %s, got %s", tt.tx, tt.want, res)
+		}
+	}
+}
+
+func TestUnits(t *testing.T) {
+	u := newUnits(11)
+	if got := u.uint64ToWei(3).String(); got != "0x1c9c380" {
+		t.Errorf("toWei(3) = %v", got)
+	}
+	if n, err := u.parseWei("0x1c9c380"); err != nil || n.Uint64() != 3 {
+		t.Errorf("parseWei = %v, %v", n, err)
+	}
+	if n, err := u.parseWei(""); err != nil || n.Sign() != 0 {
+		t.Errorf("empty amount = %v, %v", n, err)
+	}
+	// the largest amount a kortho transaction holds, and one unit more
+	max := new(big.Int).SetUint64(math.MaxUint64)
+	if n, err := u.parseWei(u.toWei(max).String()); err != nil || n.Cmp(max) != 0 {
+		t.Errorf("parseWei(max) = %v, %v", n, err)
+	}
+	tooLarge := u.toWei(new(big.Int).Add(max, big.NewInt(1))).String()
+	for _, bad := range []string{"0x1c9c381", "zz", tooLarge} {
+		if _, err := u.parseWei(bad); toErrorBody(err).Code != ErrCodeInvalidParams {
+			t.Errorf("parseWei(%v): expected invalid params, got %v", bad, err)
+		}
+	}
+
+	s := newTestServer()
+	if res := doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_getBalance","params":["0x01"]}`); !strings.Contains(res, `"result":"0x989680"`) {
+		t.Errorf("unexpected balance %s", res)
+	}
+	key, _ := crypto.GenerateKey()
+	raw, _ := types.MustSignNewTx(key, types.HomesteadSigner{}, &types.LegacyTx{Gas: 21000, GasPrice: testGasPrice, Value: hexutil.MustDecodeBig(tooLarge)}).MarshalBinary()
+	if res := doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_sendRawTransaction","params":["`+hexutil.Encode(raw)+`"]}`); !strings.Contains(res, "too large") {
+		t.Errorf("expected the value to be rejected, got %s", res)
+	}
+}
+
+func TestAccounts(t *testing.T) {
+	s := newTestServer()
+	if res := doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_accounts"}`); !strings.Contains(res, `"result":[]`) {
+		t.Errorf("expected no accounts, got %s", res)
+	}
+
+	s.keystore = keystore.NewKeyStore(t.TempDir(), keystore.LightScryptN, keystore.LightScryptP)
+	s.methods.namespaces["personal"] = true
+	addr, err := s.personal_newAccount("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_accounts"}`); !strings.Contains(res, strings.ToLower(addr.Hex())) {
+		t.Errorf("expected %v in accounts, got %s", addr.Hex(), res)
+	}
+
+	send := `{"jsonrpc":"2.0","id":1,"method":"eth_sendTransaction","params":[{"from":"` + addr.Hex() + `","to":"0x60a17Ef1B8b22e89cd6d19bcCD275863d98F2091","value":"0x989680"}]}`
+	if res := doRequest(s, send); !strings.Contains(res, "-32601") {
+		t.Errorf("expected signing methods to be disabled by default, got %s", res)
+	}
+	s.methods.namespaces[signNamespace] = true
+	if res := doRequest(s, send); !strings.Contains(res, "authentication needed") {
+		t.Errorf("expected locked account error, got %s", res)
+	}
+	if res := doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"personal_unlockAccount","params":["`+addr.Hex()+`","secret"]}`); !strings.Contains(res, "forbidden") {
+		t.Errorf("expected unlock to be forbidden by default, got %s", res)
+	}
+	s.allowInsecureUnlock = true
+	if res := doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"personal_unlockAccount","params":["`+addr.Hex()+`","wrong"]}`); !strings.Contains(res, "error") {
+		t.Errorf("expected unlock with a wrong password to fail, got %s", res)
+	}
+	if res := doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"personal_unlockAccount","params":["`+addr.Hex()+`","secret",60]}`); !strings.Contains(res, `"result":true`) {
+		t.Fatalf("unlock failed: %s", res)
+	}
+	if res := doRequest(s, send); !strings.Contains(res, `"result":"0x`) {
+		t.Errorf("expected a tx hash, got %s", res)
+	}
+	unknown := strings.Replace(send, addr.Hex(), "0x4790B510972A9826Ebc54592cF6d4C680Ae61A67", 1)
+	if res := doRequest(s, unknown); !strings.Contains(res, "unknown account") {
+		t.Errorf("expected unknown account error, got %s", res)
+	}
+
+	if ok, _ := s.personal_lockAccount(addr); !ok {
+		t.Error("lock failed")
+	}
+	if res := doRequest(s, send); !strings.Contains(res, "authentication needed") {
+		t.Errorf("expected locked account error after lock, got %s", res)
+	}
+}
+
+func TestSignTransaction(t *testing.T) {
+	s := newTestServer()
+	s.keystore = keystore.NewKeyStore(t.TempDir(), keystore.LightScryptN, keystore.LightScryptP)
+	a, _ := s.keystore.NewAccount("secret")
+	s.keystore.Unlock(a, "secret")
+	s.methods.namespaces[signNamespace] = true
+
+	res := doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_signTransaction","params":[{"from":"`+a.Address.Hex()+`","to":"0x60a17Ef1B8b22e89cd6d19bcCD275863d98F2091","nonce":"0x7"}]}`)
+	var resp struct {
+		Result SignTransactionResult `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(res), &resp); err != nil || resp.Result.Tx == nil {
+		t.Fatalf("unexpected response %s: %v", res, err)
+	}
+	var tx types.Transaction
+	if err := tx.UnmarshalBinary(resp.Result.Raw); err != nil {
+		t.Fatal(err)
+	}
+	sender, err := types.Sender(types.LatestSignerForChainID(big.NewInt(1)), &tx)
+	if err != nil || sender != a.Address {
+		t.Errorf("wrong sender %v: %v", sender, err)
+	}
+	if tx.Nonce() != 7 || tx.Gas() != GASPRICE || tx.Hash() != resp.Result.Tx.Hash() {
+		t.Errorf("unexpected tx nonce %v gas %v hash %v", tx.Nonce(), tx.Gas(), tx.Hash())
+	}
+}
+
+func TestSignMessages(t *testing.T) {
+	s := newTestServer()
+	s.methods.namespaces["personal"] = true
+	s.methods.namespaces[signNamespace] = true
+	s.keystore = keystore.NewKeyStore(t.TempDir(), keystore.LightScryptN, keystore.LightScryptP)
+	a, _ := s.keystore.NewAccount("secret")
+	addr := a.Address.Hex()
+
+	if res := doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_sign","params":["`+addr+`","0x68656c6c6f"]}`); !strings.Contains(res, "authentication needed") {
+		t.Errorf("expected locked account error, got %s", res)
+	}
+	sig, err := s.personal_sign([]byte("hello"), a.Address, new(string))
+	if err == nil {
+		t.Error("expected a wrong password to fail")
+	}
+	password := "secret"
+	if sig, err = s.personal_sign([]byte("hello"), a.Address, &password); err != nil {
+		t.Fatal(err)
+	}
+	if sig[64] != 27 && sig[64] != 28 {
+		t.Errorf("unexpected V %v", sig[64])
+	}
+	res := doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"personal_ecRecover","params":["0x68656c6c6f","`+sig.String()+`"]}`)
+	if !strings.Contains(res, strings.ToLower(addr)) {
+		t.Errorf("expected %v, got %s", addr, res)
+	}
+
+	s.keystore.Unlock(a, "secret")
+	typed := `{"types":{"EIP712Domain":[{"name":"name","type":"string"},{"name":"chainId","type":"uint256"}],"Mail":[{"name":"contents","type":"string"}]},"primaryType":"Mail","domain":{"name":"test","chainId":"1"},"message":{"contents":"hi"}}`
+	quoted, _ := json.Marshal(typed)
+	var resp struct {
+		Result hexutil.Bytes `json:"result"`
+	}
+	res = doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_signTypedData_v4","params":["`+addr+`",`+string(quoted)+`]}`)
+	if err := json.Unmarshal([]byte(res), &resp); err != nil || len(resp.Result) != 65 {
+		t.Fatalf("unexpected response %s", res)
+	}
+	var td apitypes.TypedData
+	json.Unmarshal([]byte(typed), &td)
+	hash, _, _ := apitypes.TypedDataAndHash(td)
+	resp.Result[64] -= 27
+	pub, err := crypto.SigToPub(hash, resp.Result)
+	if err != nil || crypto.PubkeyToAddress(*pub) != a.Address {
+		t.Errorf("typed data signed by the wrong key: %v", err)
+	}
+}
+
+func TestEstimateGas(t *testing.T) {
+	s := newTestServer()
+	estimate := func(call string) string {
+		return doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_estimateGas","params":[`+call+`]}`)
+	}
+
+	if res := estimate(`{"from":"0x01","to":"0x60a17Ef1B8b22e89cd6d19bcCD275863d98F2091"}`); !strings.Contains(res, `"result":"0x5208"`) {
+		t.Errorf("expected 21000 for a transfer, got %s", res)
+	}
+	if res := estimate(`{"from":"0x01","to":"0x60a17Ef1B8b22e89cd6d19bcCD275863d98F2091","gas":"0x5000"}`); !strings.Contains(res, "gas required exceeds allowance") {
+		t.Errorf("expected the gas cap to be honoured, got %s", res)
+	}
+	if res := estimate(`{"from":"0x01","to":"` + revertingContract + `","data":"0x01"}`); !strings.Contains(res, "execution reverted: nope") {
+		t.Errorf("expected the revert reason, got %s", res)
+	}
+
+	// the node cannot report gas, so calls and deployments are measured on
+	// the local EVM even when eth_call is left to the node
+	var gas hexutil.Uint64
+	res := estimate(`{"from":"0x01","to":"` + storageContract + `"}`)
+	if err := json.Unmarshal([]byte(res), &responseBody{Result: &gas}); err != nil || gas < 21000+2100 {
+		t.Errorf("expected the estimate to include the storage read, got %s", res)
+	}
+	// init code storing 1 in slot 0
+	res = estimate(`{"from":"0x01","data":"0x6001600055"}`)
+	if err := json.Unmarshal([]byte(res), &responseBody{Result: &gas}); err != nil || gas < 53000+20000 {
+		t.Errorf("expected the estimate to include the deployment's store, got %s", res)
+	}
+}
+
+func TestLocalCall(t *testing.T) {
+	s := newServer(&fakeClient{height: 16}, &Config{ChainId: "0x1", LocalCalls: true})
+	call := func(call, block string) string {
+		return doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_call","params":[`+call+`,"`+block+`"]}`)
+	}
+
+	word := func(n int) string { return fmt.Sprintf("%064x", n) }
+	if res := call(`{"to":"`+storageContract+`"}`, "latest"); !strings.Contains(res, word(42)) {
+		t.Errorf("expected slot 0 of the node's storage, got %s", res)
+	}
+	if res := call(`{"to":"`+numberContract+`"}`, "0x10"); !strings.Contains(res, word(16)) {
+		t.Errorf("expected the pinned block number, got %s", res)
+	}
+	if res := call(`{"to":"`+numberContract+`"}`, "0x5"); !strings.Contains(res, "historical state not available") {
+		t.Errorf("expected older blocks to be refused, got %s", res)
+	}
+	if res := call(`{"to":"`+storageContract+`","gas":"0x5300"}`, "latest"); !strings.Contains(res, "out of gas") {
+		t.Errorf("expected the gas limit to be honoured, got %s", res)
+	}
+
+	// the fake node reports a balance of 1 kortho base unit, 1e7 wei
+	to := `"to":"0x60a17Ef1B8b22e89cd6d19bcCD275863d98F2091"`
+	if res := call(`{"from":"0x01",`+to+`,"value":"0x989680"}`, "latest"); !strings.Contains(res, `"result":"0x"`) {
+		t.Errorf("expected the value transfer to succeed, got %s", res)
+	}
+	if res := call(`{"from":"0x01",`+to+`,"value":"0x989681"}`, "latest"); !strings.Contains(res, "insufficient funds") {
+		t.Errorf("expected the value to exceed the balance, got %s", res)
+	}
+
+	env, err := s.newCallEnv(nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gas, err := s.estimateGas(env, params{To: storageContract})
+	if err != nil || gas < 21000+2100 {
+		t.Errorf("expected the estimate to include the storage read, got %v: %v", gas, err)
+	}
+	if res, err := s.execCall(env, params{To: storageContract}, gas); err != nil || res.failed {
+		t.Errorf("call failed with the estimate %v: %v %v", gas, res, err)
+	}
+}
+
+func TestCallOverrides(t *testing.T) {
+	s := newTestServer()
+	call := func(call, overrides string) string {
+		return doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_call","params":[`+call+`,"latest",`+overrides+`]}`)
+	}
+	word := func(n int) string { return fmt.Sprintf("%064x", n) }
+	slot0 := `"0x0000000000000000000000000000000000000000000000000000000000000000"`
+	other := "0x00000000000000000000000000000000000000cc"
+
+	// the code of storageContract run at an address the node knows nothing of
+	code := `"code":"` + fakeCode[storageContract] + `"`
+	if res := call(`{"to":"`+other+`"}`, `{"`+other+`":{`+code+`,"state":{`+slot0+`:"`+"0x"+word(7)+`"}}}`); !strings.Contains(res, word(7)) {
+		t.Errorf("expected the overridden code and state, got %s", res)
+	}
+	if res := call(`{"to":"`+other+`"}`, `{"`+other+`":{`+code+`}}`); !strings.Contains(res, `"result":"0x`+word(0)) {
+		t.Errorf("expected empty storage, got %s", res)
+	}
+	if res := call(`{"to":"`+storageContract+`"}`, `{"`+storageContract+`":{"stateDiff":{`+slot0+`:"`+"0x"+word(9)+`"}}}`); !strings.Contains(res, word(9)) {
+		t.Errorf("expected the state diff, got %s", res)
+	}
+	if res := call(`{"to":"`+storageContract+`"}`, `{"`+storageContract+`":{"state":{},"stateDiff":{}}}`); !strings.Contains(res, "has both 'state' and 'stateDiff'") {
+		t.Errorf("expected state and stateDiff to conflict, got %s", res)
+	}
+
+	to := `"to":"0x60a17Ef1B8b22e89cd6d19bcCD275863d98F2091"`
+	if res := call(`{"from":"0x01",`+to+`,"value":"0x3635c9adc5dea00000"}`, `{"0x0000000000000000000000000000000000000001":{"balance":"0x3635c9adc5dea00000"}}`); !strings.Contains(res, `"result":"0x"`) {
+		t.Errorf("expected the overridden balance to cover the value, got %s", res)
+	}
+
+	res := doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_call","params":[{"to":"`+numberContract+`"},"latest",null,{"number":"0x1234"}]}`)
+	if !strings.Contains(res, word(0x1234)) {
+		t.Errorf("expected the overridden block number, got %s", res)
+	}
+}
+
+func TestCallMany(t *testing.T) {
+	s := newTestServer()
+	// counter increments slot 0, logs and returns it
+	const counter = "0x00000000000000000000000000000000000000cc"
+	const code = "0x6000546001018060005560005260206000a060206000f3"
+	inc := `{"to":"` + counter + `"}`
+	// more than the 1e7 wei the fake node reports
+	overdraw := `{"from":"0x01","to":"0x60a17Ef1B8b22e89cd6d19bcCD275863d98F2091","value":"0x989681"}`
+
+	res := doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_callMany","params":[
+		[{"transactions":[`+inc+`,`+inc+`]},{"transactions":[`+inc+`,{"to":"`+counter+`","gas":"0x5208"},`+overdraw+`,`+inc+`]}],
+		{"blockNumber":"latest"},
+		{"`+counter+`":{"code":"`+code+`"}}]}`)
+	var out struct {
+		Result [][]map[string]string
+	}
+	if err := json.Unmarshal([]byte(res), &out); err != nil || len(out.Result) != 2 {
+		t.Fatalf("unexpected eth_callMany response %s", res)
+	}
+	for i, want := range []string{"0x" + fmt.Sprintf("%064x", 1), "0x" + fmt.Sprintf("%064x", 2), "0x" + fmt.Sprintf("%064x", 3)} {
+		if got := out.Result[i/2][i%2]["value"]; got != want {
+			t.Errorf("call %d returned %v, want %v", i, got, want)
+		}
+	}
+	if msg := out.Result[1][1]["error"]; !strings.Contains(msg, "out of gas") {
+		t.Errorf("expected the call to run out of gas, got %q", msg)
+	}
+	if msg := out.Result[1][2]["error"]; !strings.Contains(msg, "insufficient funds") {
+		t.Errorf("expected the transfer to fail, got %q", msg)
+	}
+	if got, want := out.Result[1][3]["value"], "0x"+fmt.Sprintf("%064x", 4); got != want {
+		t.Errorf("call after the failed ones returned %v, want %v", got, want)
+	}
+}
+
+func TestSimulateV1(t *testing.T) {
+	s := newTestServer()
+	const counter = "0x00000000000000000000000000000000000000cc"
+	const reverter = "0x00000000000000000000000000000000000000dd"
+	inc := `{"to":"` + counter + `"}`
+
+	res := doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_simulateV1","params":[{"traceTransfers":true,"blockStateCalls":[
+		{"stateOverrides":{"`+counter+`":{"code":"0x6000546001018060005560005260206000a060206000f3"},"`+reverter+`":{"code":"0x60006000fd"}},
+		 "calls":[`+inc+`,`+inc+`,{"to":"`+reverter+`"}]},
+		{"blockOverrides":{"time":"0xffff"},
+		 "calls":[`+inc+`,{"from":"0x01","to":"0x60a17Ef1B8b22e89cd6d19bcCD275863d98F2091","value":"0x10"}]}
+	]},"latest"]}`)
+	var out struct {
+		Result []*SimulateBlockResult
+	}
+	if err := json.Unmarshal([]byte(res), &out); err != nil || len(out.Result) != 2 {
+		t.Fatalf("unexpected eth_simulateV1 response %s", res)
+	}
+	b1, b2 := out.Result[0], out.Result[1]
+	if b1.Number != 17 || b2.Number != 18 || b2.ParentHash != b1.Hash || b2.Timestamp != 0xffff {
+		t.Errorf("unexpected simulated blocks %+v %+v", b1, b2)
+	}
+	if len(b1.Calls) != 3 || len(b2.Calls) != 2 {
+		t.Fatalf("unexpected calls %+v %+v", b1.Calls, b2.Calls)
+	}
+	if got := new(big.Int).SetBytes(b2.Calls[0].ReturnData); got.Int64() != 3 {
+		t.Errorf("expected the counter to carry over between blocks, got %v", got)
+	}
+	if lg := b1.Calls[1].Logs; len(lg) != 1 || lg[0].Index != 1 || lg[0].TxIndex != 1 || lg[0].BlockHash != b1.Hash {
+		t.Errorf("unexpected logs %+v", lg)
+	}
+	if c := b1.Calls[2]; c.Status != 0 || c.Error == nil || !strings.Contains(c.Error.Message, "execution reverted") {
+		t.Errorf("expected the call to revert, got %+v", c)
+	}
+	if uint64(b1.GasUsed) != uint64(b1.Calls[0].GasUsed+b1.Calls[1].GasUsed+b1.Calls[2].GasUsed) {
+		t.Errorf("block gas %v does not add up", b1.GasUsed)
+	}
+	if lg := b2.Calls[1].Logs; len(lg) != 1 || lg[0].Address != transferLogAddress {
+		t.Errorf("expected the value transfer to be logged, got %+v", lg)
+	}
+}
+
+func TestTransactionReceipt(t *testing.T) {
+	s := newTestServer()
+	get := func(hash string) string {
+		return doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_getTransactionReceipt","params":["`+hash+`"]}`)
+	}
+
+	res := get("0x" + fakeKorthoHash)
+	for _, want := range []string{
+		`"blockNumber":"0x3"`,
+		`"transactionIndex":"0x1"`,
+		`"cumulativeGasUsed":"` + hexutil.EncodeUint64(2*GASPRICE) + `"`,
+		`"gasUsed":"` + hexutil.EncodeUint64(GASPRICE) + `"`,
+		`"status":"0x1"`,
+		`"type":"0x0"`,
+		`"to":null`,
+		`"contractAddress":"0x0000000000000000000000000000000000000003"`,
+		`"effectiveGasPrice":"` + (*hexutil.Big)(testGasPrice).String() + `"`,
+		`"logs":[]`,
+	} {
+		if !strings.Contains(res, want) {
+			t.Errorf("missing %s in %s", want, res)
+		}
+	}
+
+	for _, hash := range []string{pendingKorthoHash, "0x0606060606060606060606060606060606060606060606060606060606060606"} {
+		if res := get(hash); !strings.Contains(res, `"result":null`) {
+			t.Errorf("expected null for %v, got %s", hash, res)
+		}
+	}
+}
+
+func TestReceiptLogs(t *testing.T) {
+	lg := func(txHash string) string {
+		return `{"address":"0x0000000000000000000000000000000000000001","topics":[],"data":"0x","transactionHash":"` + txHash + `"}`
+	}
+	cli := &fakeClient{height: 16, logs: []string{lg(common.BytesToHash([]byte{2}).Hex()), lg("0x" + fakeKorthoHash)}}
+	s := newServer(cli, &Config{ChainId: "0x1"})
+	res := doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_getTransactionReceipt","params":["0x`+fakeKorthoHash+`"]}`)
+	if strings.Count(res, `"logIndex"`) != 1 || !strings.Contains(res, `"logIndex":"0x1"`) || !strings.Contains(res, `"transactionHash":"0x`+fakeKorthoHash+`"`) {
+		t.Errorf("expected the second log of the block, got %s", res)
+	}
+	if got := fmt.Sprint(cli.logRanges); got != "[[3 3]]" {
+		t.Errorf("expected one query for the block logs, got %v", got)
+	}
+}
+
+func TestUnknownBlockHash(t *testing.T) {
+	res := doRequest(newTestServer(), `{"jsonrpc":"2.0","id":1,"method":"eth_getBlockByHash","params":["0x0606060606060606060606060606060606060606060606060606060606060606",false]}`)
+	if !strings.Contains(res, `"result":null`) {
+		t.Errorf("expected null, got %s", res)
+	}
+}
+
+func TestTransactionObject(t *testing.T) {
+	s := newTestServer()
+	get := func(hash string) string {
+		return doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_getTransactionByHash","params":["`+hash+`"]}`)
+	}
+	checkFields := func(res string, fields []string) {
+		t.Helper()
+		for _, want := range fields {
+			if !strings.Contains(res, want) {
+				t.Errorf("missing %s in %s", want, res)
+			}
+		}
+	}
+
+	// not sent through the gateway, only what kortho stores is known
+	fakeTx.Nonce, fakeTx.Amount = 7, 3
+	defer func() { fakeTx.Nonce, fakeTx.Amount = 0, 0 }()
+	checkFields(get("0x"+fakeKorthoHash), []string{
+		`"nonce":"0x7"`, `"value":"` + s.units.uint64ToWei(3).String() + `"`, `"input":"0x"`,
+		`"type":"0x0"`, `"to":null`, `"transactionIndex":"0x1"`, `"v":"0x0"`, `"r":"0x0"`, `"s":"0x0"`,
+	})
+	if res := get("0x0606060606060606060606060606060606060606060606060606060606060606"); !strings.Contains(res, `"result":null`) {
+		t.Errorf("expected null for an unknown hash, got %s", res)
+	}
+
+	key, _ := crypto.GenerateKey()
+	to := common.HexToAddress("0x02")
+	tx := types.MustSignNewTx(key, types.NewLondonSigner(big.NewInt(1)), &types.DynamicFeeTx{
+		ChainID:    big.NewInt(1),
+		Nonce:      9,
+		GasTipCap:  big.NewInt(1e7),
+		GasFeeCap:  big.NewInt(1e18),
+		Gas:        30000,
+		To:         &to,
+		Value:      big.NewInt(5e7),
+		Data:       []byte{0x12, 0x34},
+		AccessList: types.AccessList{{Address: to, StorageKeys: []common.Hash{{}}}},
+	})
+	raw, _ := tx.MarshalBinary()
+	doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_sendRawTransaction","params":["`+hexutil.Encode(raw)+`"]}`)
+
+	v, r, sig := tx.RawSignatureValues()
+	price := new(big.Int).Add(testGasPrice, big.NewInt(1e7))
+	res := get(tx.Hash().Hex())
+	checkFields(res, []string{
+		`"hash":"` + tx.Hash().Hex() + `"`, `"nonce":"0x9"`, `"gas":"0x7530"`, `"value":"0x2faf080"`, `"input":"0x1234"`,
+		`"type":"0x2"`, `"chainId":"0x1"`, `"maxFeePerGas":"0xde0b6b3a7640000"`, `"maxPriorityFeePerGas":"0x989680"`,
+		`"gasPrice":"` + hexutil.EncodeBig(price) + `"`, `"accessList":[{"address":"0x0000000000000000000000000000000000000002"`,
+		`"v":"` + hexutil.EncodeBig(v) + `"`, `"r":"` + hexutil.EncodeBig(r) + `"`, `"s":"` + hexutil.EncodeBig(sig) + `"`,
+	})
+	if res := doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_getTransactionReceipt","params":["`+tx.Hash().Hex()+`"]}`); !strings.Contains(res, `"type":"0x2"`) || !strings.Contains(res, `"effectiveGasPrice":"`+hexutil.EncodeBig(price)+`"`) {
+		t.Errorf("expected the receipt to carry the transaction type and price, got %s", res)
+	}
+}
+
+func TestMinIntervals(t *testing.T) {
+	// a bare number in the config is read as nanoseconds
+	s := newServer(&fakeClient{}, &Config{ChainId: "0x1", PollInterval: 1, FilterTimeout: 1})
+	if s.pollInterval != minPollInterval || s.filters.timeout != minFilterTimeout {
+		t.Errorf("expected the minimums, got %v and %v", s.pollInterval, s.filters.timeout)
+	}
+}
+
+func TestLogFilter(t *testing.T) {
+	topic := func(b byte) string { return common.BytesToHash([]byte{b}).Hex() }
+	addr := func(b byte) string { return common.BytesToAddress([]byte{b}).Hex() }
+	fakeLog := func(a byte, topics ...byte) string {
+		ts := make([]string, len(topics))
+		for i, b := range topics {
+			ts[i] = `"` + topic(b) + `"`
+		}
+		return `{"address":"` + addr(a) + `","topics":[` + strings.Join(ts, ",") + `],"data":"0x","transactionHash":"` + topic(0xff) + `","logIndex":"` + hexutil.EncodeUint64(uint64(a)) + `"}`
+	}
+	s := newServer(&fakeClient{height: 16, logs: []string{fakeLog(1, 1, 2), fakeLog(2, 1, 3), fakeLog(3, 2)}}, &Config{ChainId: "0x1"})
+
+	for _, tt := range []struct {
+		crit string
+		want []uint
+	}{
+		{`{}`, []uint{1, 2, 3}},
+		{`{"address":"` + addr(2) + `"}`, []uint{2}},
+		{`{"address":["` + addr(1) + `","` + addr(3) + `"]}`, []uint{1, 3}},
+		{`{"topics":["` + topic(1) + `"]}`, []uint{1, 2}},
+		{`{"topics":["` + topic(1) + `","` + topic(2) + `"]}`, []uint{1}},
+		{`{"topics":[null,["` + topic(2) + `","` + topic(3) + `"]]}`, []uint{1, 2}},
+		{`{"topics":[["` + topic(2) + `","` + topic(9) + `"]],"address":["` + addr(3) + `"]}`, []uint{3}},
+		{`{"topics":[[null,"` + topic(9) + `"]]}`, []uint{1, 2, 3}},
+		{`{"topics":[[]]}`, []uint{1, 2, 3}},
+	} {
+		res := doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_getLogs","params":[`+tt.crit+`]}`)
+		var out struct{ Result []*types.Log }
+		if err := json.Unmarshal([]byte(res), &out); err != nil {
+			t.Fatalf("%s: %v %s", tt.crit, err, res)
+		}
+		var got []uint
+		for _, lg := range out.Result {
+			got = append(got, lg.Index)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: got logs %v, want %v", tt.crit, got, tt.want)
+		}
+	}
+
+	for _, crit := range []string{`{"topics":["0x01"]}`, `{"address":"0x01"}`, `{"topics":[1]}`} {
+		if res := doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_getLogs","params":[`+crit+`]}`); !strings.Contains(res, "-32602") {
+			t.Errorf("%s: expected invalid params, got %s", crit, res)
+		}
+	}
+}
+
+func TestLogLimits(t *testing.T) {
+	lg := `{"address":"0x0000000000000000000000000000000000000001","topics":[],"data":"0x","transactionHash":"0x00000000000000000000000000000000000000000000000000000000000000ff"}`
+	cli := &fakeClient{height: 16, logs: []string{lg}}
+	s := newServer(cli, &Config{ChainId: "0x1", LogsMaxRange: 10, LogsMaxResults: 3, LogsChunkSize: 4})
+	getLogs := func(crit string) string {
+		cli.logRanges = nil
+		return doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_getLogs","params":[`+crit+`]}`)
+	}
+
+	if res := getLogs(`{}`); !strings.Contains(res, `"result":[{`) || fmt.Sprint(cli.logRanges) != "[[16 16]]" {
+		t.Errorf("default range: got %s, queried %v", res, cli.logRanges)
+	}
+	if res := getLogs(`{"fromBlock":"0xe","toBlock":"0x20"}`); !strings.Contains(res, `"result":[{`) || fmt.Sprint(cli.logRanges) != "[[14 16]]" {
+		t.Errorf("range past the head: got %s, queried %v", res, cli.logRanges)
+	}
+	if res := getLogs(`{"fromBlock":"0x20","toBlock":"0x30"}`); !strings.Contains(res, `"result":[]`) || cli.logRanges != nil {
+		t.Errorf("range after the head: got %s, queried %v", res, cli.logRanges)
+	}
+	if res := getLogs(`{"fromBlock":"0x5","toBlock":"0x10"}`); !strings.Contains(res, "-32005") || !strings.Contains(res, "max block range 10") || cli.logRanges != nil {
+		t.Errorf("range too large: got %s, queried %v", res, cli.logRanges)
+	}
+	if res := getLogs(`{"fromBlock":"0x10","toBlock":"0x5"}`); !strings.Contains(res, "-32602") {
+		t.Errorf("reversed range: got %s", res)
+	}
+
+	//three chunks of one log each are within the limit
+	cli.height = 100
+	if res := getLogs(`{"fromBlock":"0x1","toBlock":"0xa"}`); strings.Count(res, `"address"`) != 3 || fmt.Sprint(cli.logRanges) != "[[1 4] [5 8] [9 10]]" {
+		t.Errorf("chunked range: got %s, queried %v", res, cli.logRanges)
+	}
+	cli.logs = []string{lg, lg}
+	if res := getLogs(`{"fromBlock":"0x1","toBlock":"0xa"}`); !strings.Contains(res, "-32005") || !strings.Contains(res, "query returned more than 3 results") || len(cli.logRanges) != 2 {
+		t.Errorf("too many results: got %s, queried %v", res, cli.logRanges)
+	}
+	if res := getLogs(`{"blockHash":"0x01"}`); !strings.Contains(res, `"result":[{`) {
+		t.Errorf("block hash: got %s", res)
+	}
+
+	// a log filter from block 0 catches up in windows of the max range, each
+	// queried in chunks
+	cli.height, cli.logs = 16, []string{lg}
+	var id responseBody
+	json.Unmarshal([]byte(doRequest(s, `{"jsonrpc":"2.0","id":1,"method":"eth_newFilter","params":[{"fromBlock":"0x0"}]}`)), &id)
+	changes := `{"jsonrpc":"2.0","id":1,"method":"eth_getFilterChanges","params":["` + fmt.Sprint(id.Result) + `"]}`
+	for _, want := range []string{"[[0 3] [4 7] [8 9]]", "[[10 13] [14 16]]", "[]"} {
+		cli.logRanges = nil
+		res := doRequest(s, changes)
+		if got := fmt.Sprint(cli.logRanges); got != want || strings.Count(res, `"address"`) != len(cli.logRanges) {
+			t.Errorf("filter changes: got %s, queried %v, want %v", res, got, want)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"bytes"
+	"math/big"
+	"strings"
+
+	"kortho/block"
+	"kortho/transaction"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// BLOCKGASLIMIT is reported as gasLimit unless a block used more.
+var BLOCKGASLIMIT uint64 = 30000000
+
+// hashList derives a trie root from a list of hashes.
+type hashList []common.Hash
+
+func (l hashList) Len() int { return len(l) }
+
+func (l hashList) EncodeIndex(i int, w *bytes.Buffer) {
+	rlp.Encode(w, l[i])
+}
+
+// blockLogs fetches the evm logs of b in a single range query and groups
+// them by the ethereum hash of their transaction. Blocks without contract
+// transactions have no logs and are not queried.
+func (s *Server) blockLogs(b *block.Block) map[common.Hash][]*types.Log {
+	contract := false
+	for _, tx := range b.Transactions {
+		if tx.EvmC != nil {
+			contract = true
+			break
+		}
+	}
+	if !contract {
+		return nil
+	}
+	logs, err := s.getLogs(reqGetLog{}, b.Height, b.Height, "")
+	if err != nil {
+		return nil
+	}
+
+	byTx := make(map[common.Hash][]*types.Log)
+	for _, lg := range logs {
+		lg.BlockNumber = b.Height
+		byTx[lg.TxHash] = append(byTx[lg.TxHash], lg)
+	}
+	return byTx
+}
+
+// txStatus returns the receipt status of a kortho transaction.
+func txStatus(tx *transaction.Transaction) uint64 {
+	if tx.EvmC != nil && !tx.EvmC.Status {
+		return types.ReceiptStatusFailed
+	}
+	return types.ReceiptStatusSuccessful
+}
+
+// isContractCreation reports whether tx deployed a contract.
+func isContractCreation(tx *transaction.Transaction) bool {
+	return tx.EvmC != nil && strings.EqualFold(tx.EvmC.Operation, "create")
+}
+
+// blockReceipts returns the receipts of the transactions of b, with their
+// logs positioned in the block. Every transaction is charged GASPRICE gas.
+func (s *Server) blockReceipts(b *block.Block) types.Receipts {
+	var (
+		receipts  = make(types.Receipts, 0, len(b.Transactions))
+		blockHash = common.BytesToHash(b.Hash)
+		logs      = s.blockLogs(b)
+		gasUsed   uint64
+		logIndex  uint
+	)
+	for i, tx := range b.Transactions {
+		gasUsed += GASPRICE
+		txHash := s.ethTxHash(tx.Hash)
+		receipt := &types.Receipt{
+			Status:            txStatus(tx),
+			CumulativeGasUsed: gasUsed,
+			Logs:              logs[txHash],
+			TxHash:            txHash,
+			GasUsed:           GASPRICE,
+			BlockHash:         blockHash,
+			BlockNumber:       new(big.Int).SetUint64(b.Height),
+			TransactionIndex:  uint(i),
+		}
+		if isContractCreation(tx) {
+			receipt.ContractAddress = tx.EvmC.ContractAddr
+		}
+		for _, lg := range receipt.Logs {
+			lg.BlockHash = blockHash
+			lg.TxIndex = uint(i)
+			lg.Index = logIndex
+			logIndex++
+		}
+		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+		receipts = append(receipts, receipt)
+	}
+	return receipts
+}
+
+// newBlock converts a kortho block into an ethereum block object. With fullTx
+// the transactions are full transaction objects, otherwise their hashes.
+func (s *Server) newBlock(b *block.Block, fullTx bool) *Block {
+	var (
+		txHashes = make(hashList, 0, len(b.Transactions))
+		txs      = make([]interface{}, 0, len(b.Transactions))
+		receipts = s.blockReceipts(b)
+		gasUsed  uint64
+	)
+	for i, tx := range b.Transactions {
+		hash := s.ethTxHash(tx.Hash)
+		txHashes = append(txHashes, hash)
+		if fullTx {
+			txs = append(txs, s.newTransaction(tx, b, uint64(i)))
+		} else {
+			txs = append(txs, hash)
+		}
+	}
+	if len(receipts) > 0 {
+		gasUsed = receipts[len(receipts)-1].CumulativeGasUsed
+	}
+
+	blk := &Block{
+		Number:           hexutil.Uint64(b.Height),
+		Hash:             common.BytesToHash(b.Hash),
+		ParentHash:       common.BytesToHash(b.PrevHash),
+		Sha3Uncles:       types.EmptyUncleHash,
+		LogsBloom:        types.CreateBloom(receipts),
+		TransactionsRoot: types.EmptyRootHash,
+		StateRoot:        common.BytesToHash(b.Root),
+		ReceiptsRoot:     types.EmptyRootHash,
+		Miner:            common.Address{},
+		Difficulty:       (*hexutil.Big)(new(big.Int)),
+		TotalDifficulty:  (*hexutil.Big)(new(big.Int)),
+		ExtraData:        hexutil.Bytes{},
+		GasLimit:         hexutil.Uint64(BLOCKGASLIMIT),
+		GasUsed:          hexutil.Uint64(gasUsed),
+		TimeStamp:        hexutil.Uint64(b.Timestamp),
+		BaseFeePerGas:    (*hexutil.Big)(s.units.minGasPrice()),
+		Transactions:     txs,
+		Uncles:           []common.Hash{},
+	}
+	if gasUsed > BLOCKGASLIMIT {
+		blk.GasLimit = blk.GasUsed
+	}
+	if len(txHashes) > 0 {
+		blk.TransactionsRoot = types.DeriveSha(txHashes, trie.NewStackTrie(nil))
+		blk.ReceiptsRoot = types.DeriveSha(receipts, trie.NewStackTrie(nil))
+	}
+
+	size, err := rlp.EncodeToBytes([]interface{}{blk.header(), []common.Hash(txHashes), blk.Uncles})
+	if err == nil {
+		blk.Size = hexutil.Uint64(len(size))
+	}
+	return blk
+}
+
+// header returns the ethereum header matching the block fields.
+func (blk *Block) header() *types.Header {
+	return &types.Header{
+		ParentHash:  blk.ParentHash,
+		UncleHash:   blk.Sha3Uncles,
+		Coinbase:    blk.Miner,
+		Root:        blk.StateRoot,
+		TxHash:      blk.TransactionsRoot,
+		ReceiptHash: blk.ReceiptsRoot,
+		Bloom:       blk.LogsBloom,
+		Difficulty:  blk.Difficulty.ToInt(),
+		Number:      new(big.Int).SetUint64(uint64(blk.Number)),
+		GasLimit:    uint64(blk.GasLimit),
+		GasUsed:     uint64(blk.GasUsed),
+		Time:        uint64(blk.TimeStamp),
+		Extra:       blk.ExtraData,
+		MixDigest:   blk.MixHash,
+		Nonce:       blk.Nonce,
+	}
+}
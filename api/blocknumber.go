@@ -0,0 +1,180 @@
+package api
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// BlockNumber is a block height or one of the block tags.
+type BlockNumber int64
+
+const (
+	SafeBlockNumber      = BlockNumber(-4)
+	FinalizedBlockNumber = BlockNumber(-3)
+	PendingBlockNumber   = BlockNumber(-2)
+	LatestBlockNumber    = BlockNumber(-1)
+	EarliestBlockNumber  = BlockNumber(0)
+)
+
+// UnmarshalJSON parses "latest", "earliest", "pending", "safe", "finalized"
+// or a hex encoded block number.
+func (bn *BlockNumber) UnmarshalJSON(data []byte) error {
+	var input string
+	if err := json.Unmarshal(data, &input); err != nil {
+		return err
+	}
+	switch strings.TrimSpace(input) {
+	case "earliest":
+		*bn = EarliestBlockNumber
+		return nil
+	case "latest", "":
+		*bn = LatestBlockNumber
+		return nil
+	case "pending":
+		*bn = PendingBlockNumber
+		return nil
+	case "safe":
+		*bn = SafeBlockNumber
+		return nil
+	case "finalized":
+		*bn = FinalizedBlockNumber
+		return nil
+	}
+
+	n, err := hexutil.DecodeUint64(input)
+	if err != nil {
+		return fmt.Errorf("invalid block number %q: %v", input, err)
+	}
+	if n > math.MaxInt64 {
+		return fmt.Errorf("block number %q too large", input)
+	}
+	*bn = BlockNumber(n)
+	return nil
+}
+
+func (bn BlockNumber) String() string {
+	switch bn {
+	case EarliestBlockNumber:
+		return "earliest"
+	case LatestBlockNumber:
+		return "latest"
+	case PendingBlockNumber:
+		return "pending"
+	case SafeBlockNumber:
+		return "safe"
+	case FinalizedBlockNumber:
+		return "finalized"
+	}
+	return hexutil.Uint64(bn).String()
+}
+
+// isTag reports whether bn is one of the tags resolved against the head.
+func (bn BlockNumber) isTag() bool {
+	return bn < EarliestBlockNumber
+}
+
+// BlockNumberOrHash is a block parameter given as a number, a tag, a block
+// hash or the EIP-1898 object {"blockNumber": ...} / {"blockHash": ...}.
+type BlockNumberOrHash struct {
+	BlockNumber      *BlockNumber `json:"blockNumber,omitempty"`
+	BlockHash        *common.Hash `json:"blockHash,omitempty"`
+	RequireCanonical bool         `json:"requireCanonical,omitempty"`
+}
+
+func (bnh *BlockNumberOrHash) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		type object BlockNumberOrHash
+		var e object
+		if err := json.Unmarshal(data, &e); err != nil {
+			return err
+		}
+		if (e.BlockNumber == nil) == (e.BlockHash == nil) {
+			return fmt.Errorf("exactly one of blockNumber or blockHash must be given")
+		}
+		*bnh = BlockNumberOrHash(e)
+		return nil
+	}
+
+	var input string
+	if err := json.Unmarshal(data, &input); err != nil {
+		return err
+	}
+	if len(input) == 66 {
+		var hash common.Hash
+		if err := hash.UnmarshalText([]byte(input)); err != nil {
+			return err
+		}
+		bnh.BlockHash = &hash
+		return nil
+	}
+	var bn BlockNumber
+	if err := bn.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	bnh.BlockNumber = &bn
+	return nil
+}
+
+// strip0x removes the 0x prefix kortho does not expect in hashes.
+func strip0x(s string) string {
+	if len(s) >= 2 && (s[:2] == "0x" || s[:2] == "0X") {
+		return s[2:]
+	}
+	return s
+}
+
+// resolveBlockNumber returns the height bn refers to. The kortho chain has
+// BFT finality, so "safe" and "finalized" are the head like "latest", and
+// there is no pending block.
+func (s *Server) resolveBlockNumber(bn BlockNumber) (uint64, error) {
+	if !bn.isTag() {
+		return uint64(bn), nil
+	}
+	return s.cli.GetBlockNumber()
+}
+
+// resolveBlock returns the height bnh refers to, a nil bnh means "latest".
+func (s *Server) resolveBlock(bnh *BlockNumberOrHash) (uint64, error) {
+	if bnh == nil {
+		return s.resolveBlockNumber(LatestBlockNumber)
+	}
+	if bnh.BlockHash != nil {
+		b, err := s.cli.GetBlockByHash(hex.EncodeToString(bnh.BlockHash[:]))
+		if err != nil {
+			return 0, newRPCError(ErrCodeServer, "header for hash %v not found", bnh.BlockHash.Hex())
+		}
+		return b.Height, nil
+	}
+	return s.resolveBlockNumber(*bnh.BlockNumber)
+}
+
+// stateBlock validates the block parameter of a state query. The kortho node
+// only serves the head state, so queries pinned to an older block are
+// refused rather than answered with the state of another block.
+func (s *Server) stateBlock(bnh *BlockNumberOrHash) error {
+	if bnh == nil || (bnh.BlockNumber != nil && bnh.BlockNumber.isTag()) {
+		return nil
+	}
+	num, err := s.resolveBlock(bnh)
+	if err != nil {
+		return err
+	}
+	head, err := s.cli.GetBlockNumber()
+	if err != nil {
+		return err
+	}
+	if num > head {
+		return newRPCError(ErrCodeServer, "header not found")
+	}
+	if num < head {
+		return newRPCError(ErrCodeServer, "historical state not available: block %d is behind the head %d", num, head)
+	}
+	return nil
+}
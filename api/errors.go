@@ -0,0 +1,114 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// JSON-RPC 2.0 and ethereum error codes
+const (
+	ErrCodeParse          = -32700
+	ErrCodeInvalidRequest = -32600
+	ErrCodeMethodNotFound = -32601
+	ErrCodeInvalidParams  = -32602
+	ErrCodeInternal       = -32603
+	ErrCodeServer         = -32000
+	ErrCodeLimitExceeded  = -32005
+	ErrCodeReverted       = 3
+)
+
+// kortho node answers unknown accounts,blocks and txs with this status message
+const korthoNotExist = "NotExist"
+
+// rpcError is an error carrying its own JSON-RPC code and optional data.
+type rpcError struct {
+	code int
+	msg  string
+	data interface{}
+}
+
+func (e *rpcError) Error() string { return e.msg }
+
+func newRPCError(code int, format string, args ...interface{}) *rpcError {
+	return &rpcError{code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+func invalidParams(format string, args ...interface{}) error {
+	return newRPCError(ErrCodeInvalidParams, format, args...)
+}
+
+func invalidRequest(format string, args ...interface{}) error {
+	return newRPCError(ErrCodeInvalidRequest, format, args...)
+}
+
+func methodNotFound(method string) error {
+	return newRPCError(ErrCodeMethodNotFound, "the method %v does not exist/is not available", method)
+}
+
+// revertError is returned when a call reverted, data is the raw return data hex.
+func revertError(msg, data string) error {
+	return &rpcError{code: ErrCodeReverted, msg: msg, data: data}
+}
+
+// isNotExist reports whether err is the kortho "NotExist" status.
+func isNotExist(err error) bool {
+	if st, ok := status.FromError(err); ok && st.Code() != codes.OK {
+		return st.Message() == korthoNotExist
+	}
+	return false
+}
+
+// isNotFound reports whether err is the node answering that an account,
+// block or transaction does not exist.
+func isNotFound(err error) bool {
+	st, ok := status.FromError(err)
+	return isNotExist(err) || (ok && st.Code() == codes.NotFound)
+}
+
+// toErrorBody maps err to a JSON-RPC error object, kortho grpc status
+// errors are translated by their status code and message.
+func toErrorBody(err error) *ErrorBody {
+	var re *rpcError
+	if errors.As(err, &re) {
+		return &ErrorBody{Code: re.code, Message: re.msg, Data: re.data}
+	}
+
+	st, ok := status.FromError(err)
+	if !ok {
+		return &ErrorBody{Code: ErrCodeServer, Message: err.Error()}
+	}
+	switch {
+	case st.Message() == korthoNotExist || st.Code() == codes.NotFound:
+		return &ErrorBody{Code: ErrCodeServer, Message: "not found"}
+	case st.Code() == codes.InvalidArgument:
+		return &ErrorBody{Code: ErrCodeInvalidParams, Message: st.Message()}
+	case st.Code() == codes.Unavailable || st.Code() == codes.DeadlineExceeded:
+		return &ErrorBody{Code: ErrCodeServer, Message: "kortho node unavailable: " + st.Message()}
+	case st.Code() == codes.Internal:
+		return &ErrorBody{Code: ErrCodeInternal, Message: st.Message()}
+	}
+	return &ErrorBody{Code: ErrCodeServer, Message: st.Message()}
+}
+
+func errResponse(jsonrpc string, id interface{}, err error) []byte {
+	if jsonrpc == "" {
+		jsonrpc = "2.0"
+	}
+	resp, mErr := json.Marshal(responseErr{JsonRPC: jsonrpc, Id: id, Error: toErrorBody(err)})
+	if mErr != nil {
+		log.Println("error response Marshal error:", mErr)
+		resp, _ = json.Marshal(responseErr{JsonRPC: jsonrpc, Id: id, Error: &ErrorBody{Code: ErrCodeInternal, Message: mErr.Error()}})
+	}
+	return resp
+}
+
+// writeError writes err as a JSON-RPC error response for request id.
+func writeError(w io.Writer, jsonrpc string, id interface{}, err error) {
+	w.Write(errResponse(jsonrpc, id, err))
+}
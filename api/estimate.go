@@ -0,0 +1,115 @@
+package api
+
+import (
+	"errors"
+	"log"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+)
+
+// estimateGasErrorRatio is the relative distance between the bounds at
+// which the gas estimation search stops.
+const estimateGasErrorRatio = 0.015
+
+// execResult is the outcome of executing a call with a given gas limit.
+type execResult struct {
+	usedGas uint64
+	failed  bool
+	ret     string //hex return data, the revert data when failed
+	err     error  //why the execution failed
+}
+
+// intrinsicGas returns the gas a transaction with para costs before any
+// code runs.
+func intrinsicGas(para params) (uint64, error) {
+	var data []byte
+	if para.Data != "" {
+		var err error
+		if data, err = hexutil.Decode(para.Data); err != nil {
+			return 0, invalidParams("invalid data: %v", err)
+		}
+	}
+	return core.IntrinsicGas(data, nil, para.To == "", true, true)
+}
+
+// execCall executes para with the gas limit on the gateway's EVM, each time
+// from the state of env. The node does not report the gas a call uses, so
+// estimates are always measured locally.
+func (s *Server) execCall(env *callEnv, para params, gas uint64) (*execResult, error) {
+	return s.execLocal(env, newCallState(env.remote), para, gas)
+}
+
+// estimateGas binary-searches the lowest gas limit para executes with in
+// env, up to the caller's gas or the block gas limit.
+func (s *Server) estimateGas(env *callEnv, para params) (uint64, error) {
+	hi := BLOCKGASLIMIT
+	if para.Gas != "" {
+		gas, err := hexutil.DecodeUint64(para.Gas)
+		if err != nil {
+			return 0, invalidParams("invalid gas: %v", err)
+		}
+		hi = gas
+	}
+	intrinsic, err := intrinsicGas(para)
+	if err != nil {
+		return 0, err
+	}
+	if hi < intrinsic {
+		return 0, newRPCError(ErrCodeServer, "gas required exceeds allowance (%d)", hi)
+	}
+
+	// plain transfers cost exactly the intrinsic gas
+	if para.To != "" && len(para.Data) <= 2 {
+		code, err := s.cli.GetCode(para.To)
+		if err != nil {
+			return 0, err
+		}
+		if len(strip0x(code)) == 0 {
+			return intrinsic, nil
+		}
+	}
+
+	res, err := s.execCall(env, para, hi)
+	if err != nil {
+		return 0, err
+	}
+	if res.failed {
+		if errors.Is(res.err, core.ErrIntrinsicGas) {
+			return 0, newRPCError(ErrCodeServer, "gas required exceeds allowance (%d)", hi)
+		}
+		log.Println("eth_estimateGas failed,ret:", res.ret)
+		return 0, s.callError(res.ret, res.err)
+	}
+
+	// the gas used is a lower bound, and the used gas plus what the 63/64
+	// rule withholds from nested calls usually suffices
+	lo := res.usedGas - 1
+	if optimistic := res.usedGas * 64 / 63; optimistic < hi {
+		res, err := s.execCall(env, para, optimistic)
+		if err != nil {
+			return 0, err
+		}
+		if res.failed {
+			lo = optimistic
+		} else {
+			hi = optimistic
+		}
+	}
+	for lo+1 < hi {
+		if float64(hi-lo)/float64(hi) < estimateGasErrorRatio {
+			break
+		}
+		mid := lo + (hi-lo)/2
+		res, err := s.execCall(env, para, mid)
+		if err != nil {
+			return 0, err
+		}
+		if res.failed {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return hi, nil
+}
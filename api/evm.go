@@ -0,0 +1,179 @@
+package api
+
+import (
+	"encoding/hex"
+	"errors"
+	"log"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	ethparams "github.com/ethereum/go-ethereum/params"
+)
+
+// newChainConfig returns the rules calls are executed with locally, every
+// fork up to London is active.
+func newChainConfig(chainId *big.Int) *ethparams.ChainConfig {
+	cfg := *ethparams.AllEthashProtocolChanges
+	cfg.ChainID = chainId
+	return &cfg
+}
+
+// callEnv is what the calls of one request execute against locally: the
+// context of the pinned block and the node's state, fetched once per request.
+type callEnv struct {
+	block    vm.BlockContext
+	remote   *remoteState
+	validate bool //check nonces, balances and fees like for a transaction
+}
+
+// newCallEnv validates the block parameter of a call and, when local is set,
+// returns the environment to execute it in. It returns nil when the call is
+// left to the node. The node only serves the head state, so only the head
+// can be pinned.
+func (s *Server) newCallEnv(bnh *BlockNumberOrHash, local bool) (*callEnv, error) {
+	if err := s.stateBlock(bnh); err != nil {
+		return nil, err
+	}
+	if !local {
+		return nil, nil
+	}
+	num, err := s.resolveBlock(bnh)
+	if err != nil {
+		return nil, err
+	}
+	b, err := s.cli.GetBlockByNumber(num)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make(map[uint64]common.Hash)
+	env := &callEnv{remote: newRemoteState(s.cli, s.units)}
+	env.block = vm.BlockContext{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		GetHash: func(n uint64) common.Hash {
+			if hash, ok := hashes[n]; ok {
+				return hash
+			}
+			b, err := s.cli.GetBlockByNumber(n)
+			if err != nil {
+				env.remote.fail(err)
+				return common.Hash{}
+			}
+			hashes[n] = common.BytesToHash(b.Hash)
+			return hashes[n]
+		},
+		GasLimit:    BLOCKGASLIMIT,
+		BlockNumber: new(big.Int).SetUint64(b.Height),
+		Time:        big.NewInt(b.Timestamp),
+		Difficulty:  new(big.Int),
+		BaseFee:     s.units.minGasPrice(),
+	}
+	return env, nil
+}
+
+// callMsg builds the message para describes, the caller's value and gas
+// price are in wei and default to zero.
+func callMsg(para params, gas uint64) (types.Message, error) {
+	var to *common.Address
+	if para.To != "" {
+		if !common.IsHexAddress(para.To) {
+			return types.Message{}, invalidParams("invalid to address %q", para.To)
+		}
+		addr := common.HexToAddress(para.To)
+		to = &addr
+	}
+	value, gasPrice := new(big.Int), new(big.Int)
+	var err error
+	if para.Value != "" {
+		if value, err = hexutil.DecodeBig(para.Value); err != nil {
+			return types.Message{}, invalidParams("invalid value: %v", err)
+		}
+	}
+	if para.GasPrice != "" {
+		if gasPrice, err = hexutil.DecodeBig(para.GasPrice); err != nil {
+			return types.Message{}, invalidParams("invalid gasPrice: %v", err)
+		}
+	}
+	var data []byte
+	if para.Data != "" {
+		if data, err = hexutil.Decode(para.Data); err != nil {
+			return types.Message{}, invalidParams("invalid data: %v", err)
+		}
+	}
+	from := common.HexToAddress(para.From)
+	return types.NewMessage(from, to, 0, value, gas, gasPrice, gasPrice, gasPrice, data, nil, true), nil
+}
+
+// callGas returns the caller's gas of para, or limit when none is given.
+func callGas(para params, limit uint64) (uint64, error) {
+	if para.Gas == "" {
+		return limit, nil
+	}
+	gas, err := hexutil.DecodeUint64(para.Gas)
+	if err != nil {
+		return 0, invalidParams("invalid gas: %v", err)
+	}
+	return gas, nil
+}
+
+// execLocal executes para with the gas limit on the gateway's EVM, against
+// st. Failures of the execution are reported in the result; invalid calls
+// and failures to read the node's state are returned as the error.
+func (s *Server) execLocal(env *callEnv, st *callState, para params, gas uint64) (*execResult, error) {
+	msg, err := callMsg(para, gas)
+	if err != nil {
+		return nil, err
+	}
+	if env.validate {
+		nonce := st.GetNonce(msg.From())
+		if para.Nonce != "" {
+			if nonce, err = hexutil.DecodeUint64(para.Nonce); err != nil {
+				return nil, invalidParams("invalid nonce: %v", err)
+			}
+		}
+		msg = types.NewMessage(msg.From(), msg.To(), nonce, msg.Value(), msg.Gas(), msg.GasPrice(), msg.GasFeeCap(), msg.GasTipCap(), msg.Data(), msg.AccessList(), false)
+	}
+	evm := vm.NewEVM(env.block, core.NewEVMTxContext(msg), st, s.chainConfig, vm.Config{NoBaseFee: !env.validate})
+	snap := st.Snapshot()
+	res, err := core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(math.MaxUint64))
+	if env.remote.err != nil {
+		return nil, env.remote.err
+	}
+	if err != nil {
+		// the gas may have been bought already
+		st.RevertToSnapshot(snap)
+		if errors.Is(err, core.ErrIntrinsicGas) {
+			return &execResult{failed: true, err: err}, nil
+		}
+		return nil, newRPCError(ErrCodeServer, "%v", err)
+	}
+	return &execResult{
+		usedGas: res.UsedGas,
+		failed:  res.Failed(),
+		ret:     hex.EncodeToString(res.ReturnData),
+		err:     res.Err,
+	}, nil
+}
+
+// verifyCall compares the local result of eth_call with the node's and logs
+// any difference. Only calls the node can reproduce, to a contract and
+// without value, are compared.
+func (s *Server) verifyCall(para params, res *execResult) {
+	if para.To == "" {
+		return
+	}
+	if value, err := hexutil.DecodeBig(para.Value); err == nil && value.Sign() != 0 {
+		return
+	}
+	ret, err := s.cli.ContractCall(para.From, para.To, para.Data)
+	if (err != nil) != res.failed || !strings.EqualFold(strip0x(ret), res.ret) {
+		log.Printf("eth_call mismatch: to=%v,data=%v local=(failed=%v,ret=%v) node=(ret=%v,err=%v)\n", para.To, para.Data, res.failed, res.ret, ret, err)
+	}
+}
@@ -0,0 +1,384 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+type filterType int
+
+const (
+	logsFilter filterType = iota
+	blockFilter
+	pendingTxFilter
+)
+
+// maxPendingHashes bounds the hashes a pending transaction filter buffers
+// between two polls.
+const maxPendingHashes = 4096
+
+// clientKey is the context key of the address identifying the caller.
+type clientKey struct{}
+
+// clientAddr identifies the caller of req by its remote address. Only when
+// the request comes from a trusted proxy is X-Forwarded-For used, walking it
+// back past the trusted proxies to the first address they did not add.
+func (s *Server) clientAddr(req *http.Request) string {
+	addr, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		addr = req.RemoteAddr
+	}
+	if !s.trustedProxies[addr] {
+		return addr
+	}
+	hops := strings.Split(req.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			break
+		}
+		addr = hop
+		if !s.trustedProxies[hop] {
+			break
+		}
+	}
+	return addr
+}
+
+func clientFromContext(ctx context.Context) string {
+	c, _ := ctx.Value(clientKey{}).(string)
+	return c
+}
+
+// filter is an installed polling filter.
+type filter struct {
+	typ      filterType
+	owner    string
+	crit     reqGetLog
+	next     uint64   //first block not reported yet
+	hashes   []string //pending tx hashes not yet reported
+	lastPoll time.Time
+}
+
+// filterManager keeps the installed filters and removes the ones not
+// polled within timeout.
+type filterManager struct {
+	mu      sync.Mutex
+	filters map[string]*filter
+	timeout time.Duration
+	limit   int //max filters per client
+	total   int //max filters of all clients
+}
+
+func newFilterManager(timeout time.Duration, limit, total int) *filterManager {
+	return &filterManager{filters: make(map[string]*filter), timeout: timeout, limit: limit, total: total}
+}
+
+func (fm *filterManager) install(f *filter) (string, error) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	if len(fm.filters) >= fm.total {
+		return "", newRPCError(ErrCodeServer, "too many filters installed, limit is %v", fm.total)
+	}
+	n := 0
+	for _, other := range fm.filters {
+		if other.owner == f.owner {
+			n++
+		}
+	}
+	if n >= fm.limit {
+		return "", newRPCError(ErrCodeServer, "too many filters, limit is %v", fm.limit)
+	}
+	id := newSubscriptionID()
+	f.lastPoll = time.Now()
+	fm.filters[id] = f
+	return id, nil
+}
+
+func (fm *filterManager) uninstall(id string) bool {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	_, ok := fm.filters[id]
+	delete(fm.filters, id)
+	return ok
+}
+
+// get returns a copy of filter id and marks it as polled.
+func (fm *filterManager) get(id string) (filter, bool) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	f, ok := fm.filters[id]
+	if !ok {
+		return filter{}, false
+	}
+	f.lastPoll = time.Now()
+	return *f, true
+}
+
+// advance records that filter id reported every block before next.
+func (fm *filterManager) advance(id string, next uint64) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	if f, ok := fm.filters[id]; ok && next > f.next {
+		f.next = next
+	}
+}
+
+// takeHashes returns and clears the pending hashes of filter id.
+func (fm *filterManager) takeHashes(id string) []string {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	f, ok := fm.filters[id]
+	if !ok {
+		return nil
+	}
+	hashes := f.hashes
+	f.hashes = nil
+	return hashes
+}
+
+// loop collects pending transaction hashes and expires idle filters.
+func (fm *filterManager) loop(pendingTxs *hashFeed) {
+	ch := make(chan string, 128)
+	defer pendingTxs.subscribe(ch)()
+
+	ticker := time.NewTicker(fm.timeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case hash := <-ch:
+			fm.mu.Lock()
+			for _, f := range fm.filters {
+				if f.typ == pendingTxFilter && len(f.hashes) < maxPendingHashes {
+					f.hashes = append(f.hashes, hash)
+				}
+			}
+			fm.mu.Unlock()
+		case <-ticker.C:
+			fm.mu.Lock()
+			for id, f := range fm.filters {
+				if time.Since(f.lastPoll) > fm.timeout {
+					log.Println("filter expired:", id)
+					delete(fm.filters, id)
+				}
+			}
+			fm.mu.Unlock()
+		}
+	}
+}
+
+// blockBound returns the block number of a numeric fromBlock/toBlock,
+// block tags do not bound the range.
+func blockBound(bn *BlockNumber) (uint64, bool) {
+	if bn == nil || bn.isTag() {
+		return 0, false
+	}
+	return uint64(*bn), true
+}
+
+func (s *Server) newFilter(ctx context.Context, typ filterType, crit reqGetLog) (string, error) {
+	head, err := s.cli.GetBlockNumber()
+	if err != nil {
+		return "", err
+	}
+	f := &filter{typ: typ, owner: clientFromContext(ctx), crit: crit, next: head + 1}
+	if from, ok := blockBound(crit.FromBlock); ok && typ == logsFilter && from <= head {
+		f.next = from
+	}
+	return s.filters.install(f)
+}
+
+// eth_newFilter installs a log filter, eth_getFilterChanges returns the
+// matching logs of the blocks produced since the last poll.
+func (s *Server) eth_newFilter(ctx context.Context, crit reqGetLog) (string, error) {
+	return s.newFilter(ctx, logsFilter, crit)
+}
+
+func (s *Server) eth_newBlockFilter(ctx context.Context) (string, error) {
+	return s.newFilter(ctx, blockFilter, reqGetLog{})
+}
+
+func (s *Server) eth_newPendingTransactionFilter(ctx context.Context) (string, error) {
+	return s.newFilter(ctx, pendingTxFilter, reqGetLog{})
+}
+
+func (s *Server) eth_uninstallFilter(id string) (bool, error) {
+	return s.filters.uninstall(id), nil
+}
+
+func (s *Server) eth_getFilterChanges(id string) (interface{}, error) {
+	f, ok := s.filters.get(id)
+	if !ok {
+		return nil, newRPCError(ErrCodeServer, "filter not found")
+	}
+
+	if f.typ == pendingTxFilter {
+		hashes := s.filters.takeHashes(id)
+		if hashes == nil {
+			hashes = []string{}
+		}
+		return hashes, nil
+	}
+
+	head, err := s.cli.GetBlockNumber()
+	if err != nil {
+		return nil, err
+	}
+	from, to := f.next, head
+	if bound, ok := blockBound(f.crit.ToBlock); ok && bound < to {
+		to = bound
+	}
+
+	if f.typ == blockFilter {
+		hashes := []string{}
+		for n := from; n <= to; n++ {
+			b, err := s.cli.GetBlockByNumber(n)
+			if err != nil {
+				s.filters.advance(id, n)
+				return nil, err
+			}
+			hashes = append(hashes, hexutil.Encode(b.Hash))
+		}
+		s.filters.advance(id, to+1)
+		return hashes, nil
+	}
+
+	// a filter behind by more than the eth_getLogs range catches up over
+	// several polls
+	if from <= to && to-from >= s.logsMaxRange {
+		to = from + s.logsMaxRange - 1
+	}
+	logs := []*types.Log{}
+	if from <= to {
+		var err error
+		if logs, err = s.queryLogs(f.crit, from, to); err != nil {
+			return nil, err
+		}
+	}
+	s.filters.advance(id, to+1)
+	return logs, nil
+}
+
+// eth_getFilterLogs returns all logs matching a log filter's criteria.
+func (s *Server) eth_getFilterLogs(id string) ([]*types.Log, error) {
+	f, ok := s.filters.get(id)
+	if !ok || f.typ != logsFilter {
+		return nil, newRPCError(ErrCodeServer, "filter not found")
+	}
+	return s.eth_getLogs(f.crit)
+}
+
+// UnmarshalJSON accepts an address or a list of them, and topic positions
+// given as null, a topic, or a list of alternative topics. A null in a list
+// of alternatives accepts any topic.
+func (crit *reqGetLog) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		FromBlock *BlockNumber      `json:"fromBlock"`
+		ToBlock   *BlockNumber      `json:"toBlock"`
+		Address   json.RawMessage   `json:"address"`
+		Topics    []json.RawMessage `json:"topics"`
+		BlockHash string            `json:"blockHash"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*crit = reqGetLog{FromBlock: raw.FromBlock, ToBlock: raw.ToBlock, BlockHash: raw.BlockHash}
+
+	if len(raw.Address) > 0 && string(raw.Address) != "null" {
+		var addrs []string
+		if raw.Address[0] == '[' {
+			if err := json.Unmarshal(raw.Address, &addrs); err != nil {
+				return fmt.Errorf("invalid address list: %v", err)
+			}
+		} else {
+			var addr string
+			if err := json.Unmarshal(raw.Address, &addr); err != nil {
+				return fmt.Errorf("invalid address: %v", err)
+			}
+			addrs = []string{addr}
+		}
+		for _, addr := range addrs {
+			if !common.IsHexAddress(addr) {
+				return fmt.Errorf("invalid address %q", addr)
+			}
+			crit.Addresses = append(crit.Addresses, common.HexToAddress(addr))
+		}
+	}
+
+	for i, rawTopic := range raw.Topics {
+		var alternatives []*string
+		if len(rawTopic) > 0 && rawTopic[0] == '[' {
+			if err := json.Unmarshal(rawTopic, &alternatives); err != nil {
+				return fmt.Errorf("invalid topic %d: %v", i, err)
+			}
+		} else {
+			var topic *string
+			if err := json.Unmarshal(rawTopic, &topic); err != nil {
+				return fmt.Errorf("invalid topic %d: %v", i, err)
+			}
+			alternatives = []*string{topic}
+		}
+
+		var position []common.Hash
+		for _, topic := range alternatives {
+			if topic == nil {
+				position = nil
+				break
+			}
+			b, err := hexutil.Decode(*topic)
+			if err != nil || len(b) != common.HashLength {
+				return fmt.Errorf("invalid topic %q", *topic)
+			}
+			position = append(position, common.BytesToHash(b))
+		}
+		crit.Topics = append(crit.Topics, position)
+	}
+	return nil
+}
+
+// matches reports whether lg matches the addresses and topics of crit.
+func (crit *reqGetLog) matches(lg *types.Log) bool {
+	if len(crit.Addresses) > 0 && !includes(crit.Addresses, lg.Address) {
+		return false
+	}
+	if len(crit.Topics) > len(lg.Topics) {
+		return false
+	}
+	for i, alternatives := range crit.Topics {
+		if len(alternatives) == 0 {
+			continue
+		}
+		match := false
+		for _, topic := range alternatives {
+			if topic == lg.Topics[i] {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return false
+		}
+	}
+	return true
+}
+
+func includes(addrs []common.Address, a common.Address) bool {
+	for _, addr := range addrs {
+		if addr == a {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// OverrideAccount replaces fields of an account for the duration of a call.
+// State replaces the whole storage, StateDiff only the given slots.
+type OverrideAccount struct {
+	Nonce     *hexutil.Uint64              `json:"nonce"`
+	Code      *hexutil.Bytes               `json:"code"`
+	Balance   *hexutil.Big                 `json:"balance"`
+	State     *map[common.Hash]common.Hash `json:"state"`
+	StateDiff *map[common.Hash]common.Hash `json:"stateDiff"`
+}
+
+// StateOverride is the state override set of eth_call.
+type StateOverride map[common.Address]OverrideAccount
+
+// BlockOverrides replaces fields of the block context a call executes in.
+type BlockOverrides struct {
+	Number     *hexutil.Big    `json:"number"`
+	Difficulty *hexutil.Big    `json:"difficulty"`
+	Time       *hexutil.Uint64 `json:"time"`
+	GasLimit   *hexutil.Uint64 `json:"gasLimit"`
+	Coinbase   *common.Address `json:"coinbase"`
+	Random     *common.Hash    `json:"random"`
+	BaseFee    *hexutil.Big    `json:"baseFee"`
+}
+
+func (account OverrideAccount) check(addr common.Address) error {
+	if account.State != nil && account.StateDiff != nil {
+		return invalidParams("account %s has both 'state' and 'stateDiff'", addr.Hex())
+	}
+	return nil
+}
+
+// apply overrides the node's state for every call of the request, the
+// overridden values are what the calls see as committed state.
+func (diff StateOverride) apply(r *remoteState) error {
+	for addr, account := range diff {
+		if err := account.check(addr); err != nil {
+			return err
+		}
+		a := r.account(addr)
+		if account.Nonce != nil {
+			a.nonce = uint64(*account.Nonce)
+		}
+		if account.Code != nil {
+			a.code = *account.Code
+		}
+		if account.Balance != nil {
+			a.balance = new(big.Int).Set(account.Balance.ToInt())
+		}
+
+		if account.State != nil {
+			slots := make(map[common.Hash]common.Hash, len(*account.State))
+			for key, value := range *account.State {
+				slots[key] = value
+			}
+			r.storage[addr] = slots
+			r.cleared[addr] = true
+		}
+		if account.StateDiff != nil {
+			if r.storage[addr] == nil {
+				r.storage[addr] = make(map[common.Hash]common.Hash)
+			}
+			for key, value := range *account.StateDiff {
+				r.storage[addr][key] = value
+			}
+		}
+	}
+	return nil
+}
+
+// applyTo overrides the state a simulation has reached between two calls,
+// the overridden values are what the following calls see as committed state.
+func (diff StateOverride) applyTo(st *callState) error {
+	for addr, account := range diff {
+		if err := account.check(addr); err != nil {
+			return err
+		}
+		obj := st.object(addr)
+		if account.Nonce != nil {
+			obj.nonce = uint64(*account.Nonce)
+		}
+		if account.Code != nil {
+			obj.code, obj.codeHash = *account.Code, crypto.Keccak256Hash(*account.Code)
+		}
+		if account.Balance != nil {
+			obj.balance = new(big.Int).Set(account.Balance.ToInt())
+		}
+
+		if account.State != nil {
+			obj.committed = make(map[common.Hash]common.Hash, len(*account.State))
+			for key, value := range *account.State {
+				obj.committed[key] = value
+			}
+			obj.fresh = true
+		}
+		if account.StateDiff != nil {
+			for key, value := range *account.StateDiff {
+				obj.committed[key] = value
+			}
+		}
+	}
+	return nil
+}
+
+// apply overrides the fields of the block context that are set.
+func (o *BlockOverrides) apply(block *vm.BlockContext) {
+	if o == nil {
+		return
+	}
+	if o.Number != nil {
+		block.BlockNumber = new(big.Int).Set(o.Number.ToInt())
+	}
+	if o.Difficulty != nil {
+		block.Difficulty = new(big.Int).Set(o.Difficulty.ToInt())
+	}
+	if o.Time != nil {
+		block.Time = new(big.Int).SetUint64(uint64(*o.Time))
+	}
+	if o.GasLimit != nil {
+		block.GasLimit = uint64(*o.GasLimit)
+	}
+	if o.Coinbase != nil {
+		block.Coinbase = *o.Coinbase
+	}
+	if o.Random != nil {
+		block.Random = o.Random
+	}
+	if o.BaseFee != nil {
+		block.BaseFee = new(big.Int).Set(o.BaseFee.ToInt())
+	}
+}
@@ -0,0 +1,215 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"runtime/debug"
+	"strings"
+)
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// defaultNamespaces are served when the config does not list any.
+var defaultNamespaces = []string{"eth", "net", "web3", "kto"}
+
+// signNamespace holds the eth_ methods that sign with managed accounts. It
+// is not a default namespace: once an account is unlocked any caller could
+// spend with it.
+const signNamespace = "sign"
+
+// jsonrpcMessage is a single JSON-RPC 2.0 request.
+type jsonrpcMessage struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// isNotification reports whether the request has no id and expects no response.
+func (msg *jsonrpcMessage) isNotification() bool {
+	return msg.ID == nil
+}
+
+// id returns the request id in a form that marshals back unchanged.
+func (msg *jsonrpcMessage) id() interface{} {
+	if msg.ID == nil {
+		return nil
+	}
+	return msg.ID
+}
+
+// method is a registered handler. The handler func takes an optional
+// context.Context followed by its positional params and returns (result, error).
+type method struct {
+	ns      string
+	fn      reflect.Value
+	hasCtx  bool
+	argType []reflect.Type
+}
+
+// registry maps method names to handlers, methods of a disabled
+// namespace are not served.
+type registry struct {
+	methods    map[string]*method
+	namespaces map[string]bool
+}
+
+func newRegistry(namespaces []string) *registry {
+	if len(namespaces) == 0 {
+		namespaces = defaultNamespaces
+	}
+	r := &registry{methods: make(map[string]*method), namespaces: make(map[string]bool)}
+	for _, ns := range namespaces {
+		r.namespaces[strings.TrimSpace(ns)] = true
+	}
+	return r
+}
+
+// register adds fn as the handler of name in the namespace of its prefix.
+func (r *registry) register(name string, fn interface{}) {
+	ns := name
+	if i := strings.Index(name, "_"); i > 0 {
+		ns = name[:i]
+	}
+	r.registerIn(ns, name, fn)
+}
+
+// registerIn adds fn as the handler of name in namespace ns, it panics if fn
+// is not a valid handler.
+func (r *registry) registerIn(ns, name string, fn interface{}) {
+	fv := reflect.ValueOf(fn)
+	ft := fv.Type()
+	if ft.Kind() != reflect.Func {
+		panic(fmt.Sprintf("register %v: handler is not a func", name))
+	}
+	if ft.NumOut() != 2 || !ft.Out(1).Implements(errorType) {
+		panic(fmt.Sprintf("register %v: handler must return (result, error)", name))
+	}
+
+	m := &method{ns: ns, fn: fv}
+	for i := 0; i < ft.NumIn(); i++ {
+		if i == 0 && ft.In(0) == contextType {
+			m.hasCtx = true
+			continue
+		}
+		m.argType = append(m.argType, ft.In(i))
+	}
+	r.methods[name] = m
+}
+
+// lookup returns the handler of name if its namespace is enabled.
+func (r *registry) lookup(name string) (*method, bool) {
+	m, ok := r.methods[name]
+	if !ok || !r.namespaces[m.ns] {
+		return nil, false
+	}
+	return m, true
+}
+
+// parseArgs decodes positional params into the handler argument types.
+// Missing trailing arguments are allowed when they are pointers.
+func (m *method) parseArgs(params json.RawMessage) ([]reflect.Value, error) {
+	var raws []json.RawMessage
+	params = bytes.TrimSpace(params)
+	if len(params) > 0 && !bytes.Equal(params, []byte("null")) {
+		if params[0] != '[' {
+			return nil, invalidParams("non-array params are not supported")
+		}
+		if err := json.Unmarshal(params, &raws); err != nil {
+			return nil, invalidParams("%v", err)
+		}
+	}
+	if len(raws) > len(m.argType) {
+		return nil, invalidParams("too many arguments, want at most %d", len(m.argType))
+	}
+
+	args := make([]reflect.Value, 0, len(m.argType))
+	for i, t := range m.argType {
+		if i >= len(raws) || bytes.Equal(raws[i], []byte("null")) {
+			if t.Kind() != reflect.Ptr && t.Kind() != reflect.Slice && t.Kind() != reflect.Map {
+				return nil, invalidParams("missing value for required argument %d", i)
+			}
+			args = append(args, reflect.Zero(t))
+			continue
+		}
+		v := reflect.New(t)
+		if err := json.Unmarshal(raws[i], v.Interface()); err != nil {
+			return nil, invalidParams("invalid argument %d: %v", i, err)
+		}
+		args = append(args, v.Elem())
+	}
+	return args, nil
+}
+
+// call decodes params and runs the handler. A panicking handler is turned
+// into an internal error instead of taking the server down.
+func (m *method) call(ctx context.Context, params json.RawMessage) (res interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("handler panic: %v\n%s", r, debug.Stack())
+			res, err = nil, newRPCError(ErrCodeInternal, "internal error")
+		}
+	}()
+
+	args, err := m.parseArgs(params)
+	if err != nil {
+		return nil, err
+	}
+	if m.hasCtx {
+		args = append([]reflect.Value{reflect.ValueOf(ctx)}, args...)
+	}
+
+	out := m.fn.Call(args)
+	if err, _ := out[1].Interface().(error); err != nil {
+		return nil, err
+	}
+	return out[0].Interface(), nil
+}
+
+// handleMsg runs a single request and returns the encoded response,
+// nil is returned for notifications.
+func (s *Server) handleMsg(ctx context.Context, msg *jsonrpcMessage) []byte {
+	if msg.Version != "2.0" {
+		return s.reply(msg, nil, invalidRequest("invalid jsonrpc version, expected 2.0"))
+	}
+	if msg.Method == "" {
+		return s.reply(msg, nil, invalidRequest("'method' not exist"))
+	}
+	log.Printf("method:%v, id:%s, params:%s\n", msg.Method, msg.ID, msg.Params)
+
+	m, ok := s.methods.lookup(msg.Method)
+	if !ok {
+		log.Printf("Error unsupport method:%v\n", msg.Method)
+		return s.reply(msg, nil, methodNotFound(msg.Method))
+	}
+
+	res, err := m.call(ctx, msg.Params)
+	if err != nil {
+		log.Printf("%v error: %v\n", msg.Method, err)
+	}
+	return s.reply(msg, res, err)
+}
+
+// reply encodes the response envelope for msg.
+func (s *Server) reply(msg *jsonrpcMessage, res interface{}, err error) []byte {
+	if msg.isNotification() {
+		return nil
+	}
+	if err != nil {
+		return errResponse("2.0", msg.id(), err)
+	}
+	resp, err := json.Marshal(responseBody{JsonRPC: "2.0", Id: msg.id(), Result: res})
+	if err != nil {
+		log.Printf("%v Marshal error: %v\n", msg.Method, err)
+		return errResponse("2.0", msg.id(), newRPCError(ErrCodeInternal, "%v", err))
+	}
+	log.Printf("%v success res>>> %s\n", msg.Method, resp)
+	return resp
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	errorSelector = crypto.Keccak256([]byte("Error(string)"))[:4]
+	panicSelector = crypto.Keccak256([]byte("Panic(uint256)"))[:4]
+)
+
+// panicReasons describes the Panic(uint256) codes of the Solidity compiler.
+var panicReasons = map[uint64]string{
+	0x00: "generic panic",
+	0x01: "assert(false)",
+	0x11: "arithmetic underflow or overflow",
+	0x12: "division or modulo by zero",
+	0x21: "enum overflow",
+	0x22: "invalid encoded storage byte array accessed",
+	0x31: "out-of-bounds array access; popping on an empty array",
+	0x32: "out-of-bounds access of an array or bytesN",
+	0x41: "out of memory",
+	0x51: "uninitialized function",
+}
+
+// errorABI holds the custom errors revert data is decoded against, by
+// selector.
+type errorABI map[[4]byte]abi.Error
+
+// loadErrorABI reads the custom errors of the JSON ABI files at paths.
+func loadErrorABI(paths []string) (errorABI, error) {
+	errs := make(errorABI)
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := abi.JSON(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid abi %v: %v", path, err)
+		}
+		for _, e := range parsed.Errors {
+			var id [4]byte
+			copy(id[:], e.ID[:4])
+			errs[id] = e
+		}
+	}
+	return errs, nil
+}
+
+// revertReason returns a readable reason for revert data: the message of
+// Error(string), the meaning of a Panic(uint256) code, or the custom error,
+// decoded when its ABI is known. Data without a selector has no reason.
+func (errs errorABI) revertReason(data []byte) string {
+	if len(data) < 4 {
+		return ""
+	}
+	switch {
+	case bytes.Equal(data[:4], errorSelector):
+		reason, err := abi.UnpackRevert(data)
+		if err != nil {
+			return ""
+		}
+		return reason
+	case bytes.Equal(data[:4], panicSelector):
+		if len(data) != 4+32 {
+			return ""
+		}
+		code := new(big.Int).SetBytes(data[4:])
+		if reason, ok := panicReasons[code.Uint64()]; ok && code.IsUint64() {
+			return reason
+		}
+		return fmt.Sprintf("unknown panic code: %#x", code)
+	}
+
+	var id [4]byte
+	copy(id[:], data)
+	if e, ok := errs[id]; ok {
+		if args, err := e.Inputs.Unpack(data[4:]); err == nil {
+			strs := make([]string, len(args))
+			for i, arg := range args {
+				strs[i] = fmt.Sprint(arg)
+			}
+			return e.Name + "(" + strings.Join(strs, ", ") + ")"
+		}
+	}
+	return fmt.Sprintf("custom error %#x", data[:4])
+}
+
+// callError converts a failed call into an error. Reverts, of the local EVM
+// or of the node, are reported with code 3, "execution reverted" and the
+// readable reason, and the raw data as hex. Other errors keep their message
+// and the return data is dropped.
+func (s *Server) callError(ret string, err error) error {
+	if !errors.Is(err, vm.ErrExecutionReverted) {
+		return err
+	}
+
+	data, _ := hexutil.Decode("0x" + strip0x(ret))
+	msg := "execution reverted"
+	if reason := s.errorABI.revertReason(data); reason != "" {
+		msg = msg + ": " + reason
+	}
+	return revertError(msg, hexutil.Encode(data))
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// signHash signs hash with the managed account addr, using password when
+// given and otherwise requiring the account to be unlocked. The signature is
+// returned with V as 27/28 like wallets do.
+func (s *Server) signHash(addr common.Address, hash []byte, password *string) (hexutil.Bytes, error) {
+	ks, err := s.accountsKeystore()
+	if err != nil {
+		return nil, err
+	}
+	account := accounts.Account{Address: addr}
+	if !ks.HasAddress(addr) {
+		return nil, newRPCError(ErrCodeServer, "unknown account %v", addr.Hex())
+	}
+
+	var sig []byte
+	if password != nil {
+		sig, err = ks.SignHashWithPassphrase(account, *password, hash)
+	} else {
+		sig, err = ks.SignHash(account, hash)
+	}
+	if errors.Is(err, keystore.ErrLocked) {
+		return nil, newRPCError(ErrCodeServer, "authentication needed: password or unlock")
+	}
+	if err != nil {
+		return nil, err
+	}
+	sig[crypto.RecoveryIDOffset] += 27
+	return sig, nil
+}
+
+// eth_sign signs the EIP-191 personal message hash of data.
+func (s *Server) eth_sign(addr common.Address, data hexutil.Bytes) (hexutil.Bytes, error) {
+	log.Println("eth_sign addr=", addr.Hex())
+	return s.signHash(addr, accounts.TextHash(data), nil)
+}
+
+// personal_sign is eth_sign with the arguments swapped, an optional
+// password signs without unlocking the account.
+func (s *Server) personal_sign(data hexutil.Bytes, addr common.Address, password *string) (hexutil.Bytes, error) {
+	log.Println("personal_sign addr=", addr.Hex())
+	return s.signHash(addr, accounts.TextHash(data), password)
+}
+
+// eth_signTypedData_v4 signs EIP-712 typed data, given either as an object
+// or as its JSON encoding in a string like MetaMask sends it.
+func (s *Server) eth_signTypedData_v4(addr common.Address, data json.RawMessage) (hexutil.Bytes, error) {
+	log.Println("eth_signTypedData_v4 addr=", addr.Hex())
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		data = json.RawMessage(str)
+	}
+	var typedData apitypes.TypedData
+	if err := json.Unmarshal(data, &typedData); err != nil {
+		return nil, invalidParams("invalid typed data: %v", err)
+	}
+	hash, _, err := apitypes.TypedDataAndHash(typedData)
+	if err != nil {
+		return nil, invalidParams("invalid typed data: %v", err)
+	}
+	return s.signHash(addr, hash, nil)
+}
+
+// personal_ecRecover returns the address that signed data with eth_sign or
+// personal_sign.
+func (s *Server) personal_ecRecover(data, sig hexutil.Bytes) (common.Address, error) {
+	if len(sig) != crypto.SignatureLength {
+		return common.Address{}, invalidParams("signature must be %d bytes long", crypto.SignatureLength)
+	}
+	if sig[crypto.RecoveryIDOffset] != 27 && sig[crypto.RecoveryIDOffset] != 28 {
+		return common.Address{}, invalidParams("invalid Ethereum signature (V is not 27 or 28)")
+	}
+	rsv := make([]byte, len(sig))
+	copy(rsv, sig)
+	rsv[crypto.RecoveryIDOffset] -= 27
+
+	pub, err := crypto.SigToPub(accounts.TextHash(data), rsv)
+	if err != nil {
+		return common.Address{}, invalidParams("invalid signature: %v", err)
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
@@ -0,0 +1,261 @@
+package api
+
+import (
+	"log"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	// maxSimulateBlocks is the most blocks one eth_simulateV1 call simulates.
+	maxSimulateBlocks = 256
+	// simulateBlockTime is how far apart in seconds simulated blocks are
+	// unless their time is overridden, as in geth.
+	simulateBlockTime = 12
+)
+
+var (
+	// transfers of the native coin are reported as ERC-20 Transfer logs of
+	// this address when eth_simulateV1 traces transfers (ERC-7528)
+	transferLogAddress = common.HexToAddress("0xEeeeeEeeeEeEeeEeEeEeeEEEeeeeEeeeeeeeEEeE")
+	transferTopic      = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+)
+
+// Bundle is a list of eth_callMany calls executed in the same block.
+type Bundle struct {
+	Transactions  []params        `json:"transactions"`
+	BlockOverride *BlockOverrides `json:"blockOverride"`
+}
+
+// StateContext is the block the calls of eth_callMany execute on.
+type StateContext struct {
+	BlockNumber      *BlockNumberOrHash `json:"blockNumber"`
+	TransactionIndex *int               `json:"transactionIndex"`
+}
+
+// SimulateOptions is the request of eth_simulateV1.
+type SimulateOptions struct {
+	BlockStateCalls []SimulateBlock `json:"blockStateCalls"`
+	TraceTransfers  bool            `json:"traceTransfers"`
+	Validation      bool            `json:"validation"`
+}
+
+// SimulateBlock is a block of calls of eth_simulateV1, its overrides are
+// applied before its calls execute.
+type SimulateBlock struct {
+	BlockOverrides *BlockOverrides `json:"blockOverrides"`
+	StateOverrides StateOverride   `json:"stateOverrides"`
+	Calls          []params        `json:"calls"`
+}
+
+// SimulateBlockResult is a simulated block with the results of its calls.
+type SimulateBlockResult struct {
+	Number        hexutil.Uint64       `json:"number"`
+	Hash          common.Hash          `json:"hash"`
+	ParentHash    common.Hash          `json:"parentHash"`
+	Timestamp     hexutil.Uint64       `json:"timestamp"`
+	GasLimit      hexutil.Uint64       `json:"gasLimit"`
+	GasUsed       hexutil.Uint64       `json:"gasUsed"`
+	Miner         common.Address       `json:"miner"`
+	BaseFeePerGas *hexutil.Big         `json:"baseFeePerGas"`
+	Calls         []SimulateCallResult `json:"calls"`
+}
+
+// SimulateCallResult is the outcome of a call of eth_simulateV1, Error holds
+// the revert reason and data of a failed call.
+type SimulateCallResult struct {
+	ReturnData hexutil.Bytes  `json:"returnData"`
+	Logs       []*types.Log   `json:"logs"`
+	GasUsed    hexutil.Uint64 `json:"gasUsed"`
+	Status     hexutil.Uint64 `json:"status"`
+	Error      *ErrorBody     `json:"error,omitempty"`
+}
+
+// eth_callMany executes bundles of calls one after another, every call sees
+// the changes of the calls before it. A call's result is {"value": data} or,
+// when it failed or could not be executed, {"error": message}. Only failing
+// to read the node's state fails the whole request.
+func (s *Server) eth_callMany(bundles []Bundle, ctx StateContext, overrides StateOverride) ([][]map[string]interface{}, error) {
+	log.Println("eth_callMany bundles:", len(bundles))
+	if ctx.TransactionIndex != nil && *ctx.TransactionIndex != -1 {
+		return nil, invalidParams("transactionIndex is not supported, the kortho node only serves the state at the end of a block")
+	}
+	env, err := s.newCallEnv(ctx.BlockNumber, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := overrides.apply(env.remote); err != nil {
+		return nil, err
+	}
+
+	st := newCallState(env.remote)
+	results := make([][]map[string]interface{}, 0, len(bundles))
+	for _, bundle := range bundles {
+		benv := &callEnv{block: env.block, remote: env.remote}
+		bundle.BlockOverride.apply(&benv.block)
+
+		res := make([]map[string]interface{}, 0, len(bundle.Transactions))
+		for _, para := range bundle.Transactions {
+			r, err := s.callOne(benv, st, para)
+			if env.remote.err != nil {
+				return nil, env.remote.err
+			}
+			st.finalise()
+			if err != nil {
+				res = append(res, map[string]interface{}{"error": toErrorBody(err).Message})
+			} else if r.failed {
+				res = append(res, map[string]interface{}{"error": toErrorBody(s.callError(r.ret, r.err)).Message})
+			} else {
+				res = append(res, map[string]interface{}{"value": "0x" + r.ret})
+			}
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// callOne executes a call of eth_callMany with its gas or the block gas limit.
+func (s *Server) callOne(env *callEnv, st *callState, para params) (*execResult, error) {
+	gas, err := callGas(para, env.block.GasLimit)
+	if err != nil {
+		return nil, err
+	}
+	return s.execLocal(env, st, para, gas)
+}
+
+// eth_simulateV1 executes blocks of calls on top of blockNr, each call sees
+// the changes of the calls before it.
+func (s *Server) eth_simulateV1(opts SimulateOptions, blockNr *BlockNumberOrHash) ([]*SimulateBlockResult, error) {
+	log.Println("eth_simulateV1 blocks:", len(opts.BlockStateCalls))
+	if len(opts.BlockStateCalls) > maxSimulateBlocks {
+		return nil, invalidParams("too many blocks, at most %d can be simulated", maxSimulateBlocks)
+	}
+	env, err := s.newCallEnv(blockNr, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		st     = newCallState(env.remote)
+		parent = env.block.GetHash(env.block.BlockNumber.Uint64())
+		prev   = env.block
+		blocks = make([]*SimulateBlockResult, 0, len(opts.BlockStateCalls))
+	)
+	for _, sb := range opts.BlockStateCalls {
+		blk := prev
+		blk.BlockNumber = new(big.Int).Add(prev.BlockNumber, common.Big1)
+		blk.Time = new(big.Int).Add(prev.Time, big.NewInt(simulateBlockTime))
+		sb.BlockOverrides.apply(&blk)
+		if blk.BlockNumber.Cmp(prev.BlockNumber) <= 0 {
+			return nil, invalidParams("block numbers must be in order: %v <= %v", blk.BlockNumber, prev.BlockNumber)
+		}
+		if blk.Time.Cmp(prev.Time) <= 0 {
+			return nil, invalidParams("block timestamps must be in order: %v <= %v", blk.Time, prev.Time)
+		}
+		if opts.TraceTransfers {
+			blk.Transfer = tracedTransfer
+		}
+		if err := sb.StateOverrides.applyTo(st); err != nil {
+			return nil, err
+		}
+
+		res, err := s.simulateBlock(&callEnv{block: blk, remote: env.remote, validate: opts.Validation}, st, sb.Calls)
+		if err != nil {
+			return nil, err
+		}
+		header := &types.Header{
+			ParentHash: parent,
+			UncleHash:  types.EmptyUncleHash,
+			Coinbase:   blk.Coinbase,
+			Difficulty: blk.Difficulty,
+			Number:     blk.BlockNumber,
+			GasLimit:   blk.GasLimit,
+			GasUsed:    uint64(res.GasUsed),
+			Time:       blk.Time.Uint64(),
+			BaseFee:    blk.BaseFee,
+		}
+		res.Hash, res.ParentHash = header.Hash(), parent
+		res.Number = hexutil.Uint64(blk.BlockNumber.Uint64())
+		res.Timestamp = hexutil.Uint64(header.Time)
+		res.GasLimit = hexutil.Uint64(blk.GasLimit)
+		res.Miner = blk.Coinbase
+		res.BaseFeePerGas = (*hexutil.Big)(blk.BaseFee)
+		for _, call := range res.Calls {
+			for _, lg := range call.Logs {
+				lg.BlockHash = res.Hash
+			}
+		}
+		blocks = append(blocks, res)
+		parent, prev = res.Hash, blk
+	}
+	return blocks, nil
+}
+
+// simulateBlock executes the calls of a simulated block in env, the block
+// fields of the result other than the gas used are left to the caller.
+func (s *Server) simulateBlock(env *callEnv, st *callState, calls []params) (*SimulateBlockResult, error) {
+	var (
+		res      = &SimulateBlockResult{Calls: make([]SimulateCallResult, 0, len(calls))}
+		gasUsed  uint64
+		logIndex uint
+	)
+	for i, para := range calls {
+		var remaining uint64
+		if gasUsed < env.block.GasLimit {
+			remaining = env.block.GasLimit - gasUsed
+		}
+		gas, err := callGas(para, remaining)
+		if err != nil {
+			return nil, err
+		}
+		if gas > remaining {
+			return nil, newRPCError(ErrCodeServer, "block gas limit reached: call %d wants %d, %d left", i, gas, remaining)
+		}
+		r, err := s.execLocal(env, st, para, gas)
+		if err != nil {
+			return nil, err
+		}
+		logs := st.finalise()
+		gasUsed += r.usedGas
+
+		call := SimulateCallResult{
+			ReturnData: common.FromHex(r.ret),
+			Logs:       []*types.Log{},
+			GasUsed:    hexutil.Uint64(r.usedGas),
+			Status:     hexutil.Uint64(types.ReceiptStatusSuccessful),
+		}
+		if r.failed {
+			call.Status = hexutil.Uint64(types.ReceiptStatusFailed)
+			call.Error = toErrorBody(s.callError(r.ret, r.err))
+		}
+		for _, lg := range logs {
+			lg.BlockNumber = env.block.BlockNumber.Uint64()
+			lg.TxIndex = uint(i)
+			lg.Index = logIndex
+			logIndex++
+			call.Logs = append(call.Logs, lg)
+		}
+		res.Calls = append(res.Calls, call)
+	}
+	res.GasUsed = hexutil.Uint64(gasUsed)
+	return res, nil
+}
+
+// tracedTransfer transfers the native coin and logs the transfer.
+func tracedTransfer(db vm.StateDB, sender, recipient common.Address, amount *big.Int) {
+	core.Transfer(db, sender, recipient, amount)
+	if amount.Sign() <= 0 {
+		return
+	}
+	db.AddLog(&types.Log{
+		Address: transferLogAddress,
+		Topics:  []common.Hash{transferTopic, common.BytesToHash(sender.Bytes()), common.BytesToHash(recipient.Bytes())},
+		Data:    common.BigToHash(amount).Bytes(),
+	})
+}
@@ -0,0 +1,390 @@
+package api
+
+import (
+	"math/big"
+
+	"metamaskServer/client"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// remoteState reads accounts and storage from the kortho node, caching every
+// value for the lifetime of one request. The vm.StateDB interface has no way
+// to report a failed fetch, so the first failure is kept in err and the value
+// reads as zero; callers check err after executing.
+type remoteState struct {
+	cli   client.Client
+	units units
+
+	accounts map[common.Address]*remoteAccount
+	storage  map[common.Address]map[common.Hash]common.Hash
+	cleared  map[common.Address]bool //storage replaced by a state override
+	err      error
+}
+
+type remoteAccount struct {
+	balance *big.Int //wei
+	nonce   uint64
+	code    []byte
+}
+
+func newRemoteState(cli client.Client, u units) *remoteState {
+	return &remoteState{
+		cli:      cli,
+		units:    u,
+		accounts: make(map[common.Address]*remoteAccount),
+		storage:  make(map[common.Address]map[common.Hash]common.Hash),
+		cleared:  make(map[common.Address]bool),
+	}
+}
+
+func (r *remoteState) fail(err error) {
+	if r.err == nil && !isNotExist(err) {
+		r.err = err
+	}
+}
+
+func (r *remoteState) account(addr common.Address) *remoteAccount {
+	if a, ok := r.accounts[addr]; ok {
+		return a
+	}
+	a := &remoteAccount{balance: new(big.Int)}
+	if blc, err := r.cli.GetBalance(addr.Hex()); err != nil {
+		r.fail(err)
+	} else {
+		a.balance = r.units.toWei(blc).ToInt()
+	}
+	if nonce, err := r.cli.GetNonce(addr.Hex()); err != nil {
+		r.fail(err)
+	} else {
+		a.nonce = nonce
+	}
+	if code, err := r.cli.GetCode(addr.Hex()); err != nil {
+		r.fail(err)
+	} else {
+		a.code = common.FromHex(code)
+	}
+	r.accounts[addr] = a
+	return a
+}
+
+func (r *remoteState) slot(addr common.Address, key common.Hash) common.Hash {
+	slots, ok := r.storage[addr]
+	if !ok {
+		slots = make(map[common.Hash]common.Hash)
+		r.storage[addr] = slots
+	}
+	if v, ok := slots[key]; ok || r.cleared[addr] {
+		return v
+	}
+	var v common.Hash
+	if res, err := r.cli.GetStorageAt(addr.Hex(), key.Hex()); err != nil {
+		r.fail(err)
+	} else {
+		v = common.HexToHash(res)
+	}
+	slots[key] = v
+	return v
+}
+
+// stateObject is an account as modified by the executing call.
+type stateObject struct {
+	balance  *big.Int
+	nonce    uint64
+	code     []byte
+	codeHash common.Hash
+
+	storage   map[common.Hash]common.Hash //slots written by the call
+	committed map[common.Hash]common.Hash //slot values before the call
+	fresh     bool                        //storage starts empty rather than at the node's
+	created   bool
+	suicided  bool
+}
+
+func (obj *stateObject) empty() bool {
+	return obj.nonce == 0 && obj.balance.Sign() == 0 && len(obj.code) == 0
+}
+
+// callState is the vm.StateDB a call executes against: the node's state read
+// through a remoteState, overlaid with the changes the call makes. Changes
+// are journaled so snapshots can be reverted.
+type callState struct {
+	remote  *remoteState
+	objects map[common.Address]*stateObject
+	journal []func()
+
+	refund   uint64
+	logs     []*types.Log
+	accessed map[common.Address]map[common.Hash]bool
+}
+
+func newCallState(remote *remoteState) *callState {
+	return &callState{
+		remote:   remote,
+		objects:  make(map[common.Address]*stateObject),
+		accessed: make(map[common.Address]map[common.Hash]bool),
+	}
+}
+
+func (s *callState) object(addr common.Address) *stateObject {
+	if obj, ok := s.objects[addr]; ok {
+		return obj
+	}
+	a := s.remote.account(addr)
+	obj := &stateObject{
+		balance:   new(big.Int).Set(a.balance),
+		nonce:     a.nonce,
+		code:      a.code,
+		codeHash:  crypto.Keccak256Hash(a.code),
+		storage:   make(map[common.Hash]common.Hash),
+		committed: make(map[common.Hash]common.Hash),
+	}
+	s.objects[addr] = obj
+	return obj
+}
+
+func (s *callState) CreateAccount(addr common.Address) {
+	prev := s.object(addr)
+	s.objects[addr] = &stateObject{
+		balance:   new(big.Int).Set(prev.balance),
+		codeHash:  crypto.Keccak256Hash(nil),
+		storage:   make(map[common.Hash]common.Hash),
+		committed: make(map[common.Hash]common.Hash),
+		fresh:     true,
+		created:   true,
+	}
+	s.journal = append(s.journal, func() { s.objects[addr] = prev })
+}
+
+func (s *callState) setBalance(addr common.Address, balance *big.Int) {
+	obj := s.object(addr)
+	prev := obj.balance
+	obj.balance = balance
+	s.journal = append(s.journal, func() { obj.balance = prev })
+}
+
+func (s *callState) SubBalance(addr common.Address, amount *big.Int) {
+	s.setBalance(addr, new(big.Int).Sub(s.GetBalance(addr), amount))
+}
+
+func (s *callState) AddBalance(addr common.Address, amount *big.Int) {
+	s.setBalance(addr, new(big.Int).Add(s.GetBalance(addr), amount))
+}
+
+func (s *callState) GetBalance(addr common.Address) *big.Int {
+	return new(big.Int).Set(s.object(addr).balance)
+}
+
+func (s *callState) GetNonce(addr common.Address) uint64 {
+	return s.object(addr).nonce
+}
+
+func (s *callState) SetNonce(addr common.Address, nonce uint64) {
+	obj := s.object(addr)
+	prev := obj.nonce
+	obj.nonce = nonce
+	s.journal = append(s.journal, func() { obj.nonce = prev })
+}
+
+func (s *callState) GetCodeHash(addr common.Address) common.Hash {
+	if !s.Exist(addr) {
+		return common.Hash{}
+	}
+	return s.object(addr).codeHash
+}
+
+func (s *callState) GetCode(addr common.Address) []byte {
+	return s.object(addr).code
+}
+
+func (s *callState) SetCode(addr common.Address, code []byte) {
+	obj := s.object(addr)
+	prevCode, prevHash := obj.code, obj.codeHash
+	obj.code, obj.codeHash = code, crypto.Keccak256Hash(code)
+	s.journal = append(s.journal, func() { obj.code, obj.codeHash = prevCode, prevHash })
+}
+
+func (s *callState) GetCodeSize(addr common.Address) int {
+	return len(s.object(addr).code)
+}
+
+func (s *callState) AddRefund(gas uint64) {
+	prev := s.refund
+	s.refund += gas
+	s.journal = append(s.journal, func() { s.refund = prev })
+}
+
+func (s *callState) SubRefund(gas uint64) {
+	prev := s.refund
+	if gas > s.refund {
+		gas = s.refund
+	}
+	s.refund -= gas
+	s.journal = append(s.journal, func() { s.refund = prev })
+}
+
+func (s *callState) GetRefund() uint64 {
+	return s.refund
+}
+
+func (s *callState) GetCommittedState(addr common.Address, key common.Hash) common.Hash {
+	obj := s.object(addr)
+	if v, ok := obj.committed[key]; ok {
+		return v
+	}
+	if obj.fresh {
+		return common.Hash{}
+	}
+	v := s.remote.slot(addr, key)
+	obj.committed[key] = v
+	return v
+}
+
+func (s *callState) GetState(addr common.Address, key common.Hash) common.Hash {
+	if v, ok := s.object(addr).storage[key]; ok {
+		return v
+	}
+	return s.GetCommittedState(addr, key)
+}
+
+func (s *callState) SetState(addr common.Address, key, value common.Hash) {
+	obj := s.object(addr)
+	prev, ok := obj.storage[key]
+	obj.storage[key] = value
+	s.journal = append(s.journal, func() {
+		if ok {
+			obj.storage[key] = prev
+		} else {
+			delete(obj.storage, key)
+		}
+	})
+}
+
+func (s *callState) Suicide(addr common.Address) bool {
+	if !s.Exist(addr) {
+		return false
+	}
+	obj := s.object(addr)
+	prevSuicided, prevBalance := obj.suicided, obj.balance
+	obj.suicided, obj.balance = true, new(big.Int)
+	s.journal = append(s.journal, func() { obj.suicided, obj.balance = prevSuicided, prevBalance })
+	return true
+}
+
+func (s *callState) HasSuicided(addr common.Address) bool {
+	return s.object(addr).suicided
+}
+
+// Exist reports whether addr exists. The node does not tell empty accounts
+// from missing ones, which EIP-161 makes equivalent anyway.
+func (s *callState) Exist(addr common.Address) bool {
+	obj := s.object(addr)
+	return obj.created || obj.suicided || !obj.empty()
+}
+
+func (s *callState) Empty(addr common.Address) bool {
+	return s.object(addr).empty()
+}
+
+func (s *callState) PrepareAccessList(sender common.Address, dest *common.Address, precompiles []common.Address, txAccesses types.AccessList) {
+	s.AddAddressToAccessList(sender)
+	if dest != nil {
+		s.AddAddressToAccessList(*dest)
+	}
+	for _, addr := range precompiles {
+		s.AddAddressToAccessList(addr)
+	}
+	for _, el := range txAccesses {
+		s.AddAddressToAccessList(el.Address)
+		for _, key := range el.StorageKeys {
+			s.AddSlotToAccessList(el.Address, key)
+		}
+	}
+}
+
+func (s *callState) AddressInAccessList(addr common.Address) bool {
+	_, ok := s.accessed[addr]
+	return ok
+}
+
+func (s *callState) SlotInAccessList(addr common.Address, slot common.Hash) (addressOk bool, slotOk bool) {
+	slots, ok := s.accessed[addr]
+	return ok, slots[slot]
+}
+
+func (s *callState) AddAddressToAccessList(addr common.Address) {
+	if s.AddressInAccessList(addr) {
+		return
+	}
+	s.accessed[addr] = make(map[common.Hash]bool)
+	s.journal = append(s.journal, func() { delete(s.accessed, addr) })
+}
+
+func (s *callState) AddSlotToAccessList(addr common.Address, slot common.Hash) {
+	s.AddAddressToAccessList(addr)
+	if s.accessed[addr][slot] {
+		return
+	}
+	s.accessed[addr][slot] = true
+	s.journal = append(s.journal, func() { delete(s.accessed[addr], slot) })
+}
+
+func (s *callState) RevertToSnapshot(id int) {
+	for i := len(s.journal) - 1; i >= id; i-- {
+		s.journal[i]()
+	}
+	s.journal = s.journal[:id]
+}
+
+func (s *callState) Snapshot() int {
+	return len(s.journal)
+}
+
+func (s *callState) AddLog(lg *types.Log) {
+	n := len(s.logs)
+	lg.Index = uint(n)
+	s.logs = append(s.logs, lg)
+	s.journal = append(s.journal, func() { s.logs = s.logs[:n] })
+}
+
+// finalise ends a call of a simulation: what the call wrote becomes the
+// committed state of the next one, and its journal, refund, access list and
+// logs are reset. The logs of the call are returned.
+func (s *callState) finalise() []*types.Log {
+	for addr, obj := range s.objects {
+		if obj.suicided {
+			s.objects[addr] = &stateObject{
+				balance:   new(big.Int),
+				codeHash:  crypto.Keccak256Hash(nil),
+				storage:   make(map[common.Hash]common.Hash),
+				committed: make(map[common.Hash]common.Hash),
+				fresh:     true,
+			}
+			continue
+		}
+		for key, value := range obj.storage {
+			obj.committed[key] = value
+		}
+		obj.storage = make(map[common.Hash]common.Hash)
+		obj.created = false
+	}
+	logs := s.logs
+	s.journal, s.refund, s.logs = nil, 0, nil
+	s.accessed = make(map[common.Address]map[common.Hash]bool)
+	return logs
+}
+
+func (s *callState) AddPreimage(common.Hash, []byte) {}
+
+// ForEachStorage iterates the slots written by the call, the node offers no
+// way to enumerate an account's storage.
+func (s *callState) ForEachStorage(addr common.Address, cb func(key, value common.Hash) bool) error {
+	for key, value := range s.object(addr).storage {
+		if !cb(key, value) {
+			break
+		}
+	}
+	return nil
+}
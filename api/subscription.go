@@ -0,0 +1,217 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// maxCatchUp bounds how many blocks a subscription replays after the node
+// was unreachable for a while.
+const maxCatchUp = 64
+
+func newSubscriptionID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hexutil.Encode(b)
+}
+
+// addSub registers a new subscription of the connection.
+func (c *wsConn) addSub(ctx context.Context, limit int) (string, context.Context, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.subs) >= limit {
+		return "", nil, newRPCError(ErrCodeServer, "too many subscriptions, limit is %v", limit)
+	}
+	id := newSubscriptionID()
+	subCtx, cancel := context.WithCancel(ctx)
+	c.subs[id] = cancel
+	return id, subCtx, nil
+}
+
+func (c *wsConn) removeSub(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cancel, ok := c.subs[id]
+	if ok {
+		cancel()
+		delete(c.subs, id)
+	}
+	return ok
+}
+
+// eth_subscribe starts a "newHeads", "logs" or "newPendingTransactions"
+// subscription, it is only available over websocket.
+func (s *Server) eth_subscribe(ctx context.Context, kind string, crit *reqGetLog) (string, error) {
+	c, ok := connFromContext(ctx)
+	if !ok {
+		return "", newRPCError(ErrCodeMethodNotFound, "notifications not supported")
+	}
+
+	var run func(ctx context.Context, c *wsConn, id string)
+	switch kind {
+	case "newHeads":
+		run = s.pollHeads
+	case "logs":
+		if crit == nil {
+			crit = &reqGetLog{}
+		}
+		crit := *crit
+		run = func(ctx context.Context, c *wsConn, id string) { s.pollLogs(ctx, c, id, crit) }
+	case "newPendingTransactions":
+		run = s.watchPendingTxs
+	default:
+		return "", invalidParams("unsupported subscription type %q", kind)
+	}
+
+	id, subCtx, err := c.addSub(ctx, s.maxSubs)
+	if err != nil {
+		return "", err
+	}
+	log.Println("eth_subscribe:", kind, id)
+	go func() {
+		defer c.removeSub(id)
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("subscription %v panic: %v\n%s", id, r, debug.Stack())
+			}
+		}()
+		run(subCtx, c, id)
+	}()
+	return id, nil
+}
+
+func (s *Server) eth_unsubscribe(ctx context.Context, id string) (bool, error) {
+	c, ok := connFromContext(ctx)
+	if !ok {
+		return false, newRPCError(ErrCodeMethodNotFound, "notifications not supported")
+	}
+	return c.removeSub(id), nil
+}
+
+// pollHeads polls the node height and notifies every new block.
+func (s *Server) pollHeads(ctx context.Context, c *wsConn, id string) {
+	s.pollBlocks(ctx, func(from, to uint64) (uint64, error) {
+		for n := from; n <= to; n++ {
+			blk, err := s.eth_getBlockByNumber(BlockNumber(n), nil)
+			if err != nil {
+				return n - 1, err
+			}
+			if err := c.notify(id, blk); err != nil {
+				return n - 1, err
+			}
+		}
+		return to, nil
+	})
+}
+
+// pollLogs notifies the logs matching crit of every new block range.
+func (s *Server) pollLogs(ctx context.Context, c *wsConn, id string, crit reqGetLog) {
+	s.pollBlocks(ctx, func(from, to uint64) (uint64, error) {
+		logs, err := s.queryLogs(crit, from, to)
+		if err != nil {
+			return from - 1, err
+		}
+		for _, lg := range logs {
+			if err := c.notify(id, lg); err != nil {
+				return to, err
+			}
+		}
+		return to, nil
+	})
+}
+
+// pollBlocks calls handle with every range of blocks produced since the
+// subscription started, handle returns the last block it processed.
+func (s *Server) pollBlocks(ctx context.Context, handle func(from, to uint64) (uint64, error)) {
+	last, err := s.cli.GetBlockNumber()
+	if err != nil {
+		log.Println("subscription GetBlockNumber error:", err)
+	}
+
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		head, err := s.cli.GetBlockNumber()
+		if err != nil {
+			log.Println("subscription GetBlockNumber error:", err)
+			continue
+		}
+		if head <= last {
+			continue
+		}
+		if head-last > maxCatchUp {
+			last = head - maxCatchUp
+		}
+		done, err := handle(last+1, head)
+		last = done
+		if err != nil {
+			log.Println("subscription poll error:", err)
+		}
+	}
+}
+
+// hashFeed fans transaction hashes out to its subscribers. Unlike event.Feed
+// it never waits for a subscriber: a hash is dropped for subscribers whose
+// channel is full, so a slow websocket client cannot stall eth_sendRawTransaction.
+type hashFeed struct {
+	mu   sync.Mutex
+	subs map[chan<- string]struct{}
+}
+
+// subscribe delivers the hashes sent from now on to ch until the returned
+// func is called.
+func (f *hashFeed) subscribe(ch chan<- string) func() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.subs == nil {
+		f.subs = make(map[chan<- string]struct{})
+	}
+	f.subs[ch] = struct{}{}
+	return func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		delete(f.subs, ch)
+	}
+}
+
+func (f *hashFeed) send(hash string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch := range f.subs {
+		select {
+		case ch <- hash:
+		default:
+			log.Println("pending tx subscriber lagging, dropped:", hash)
+		}
+	}
+}
+
+// watchPendingTxs notifies the hashes of transactions sent through the gateway.
+func (s *Server) watchPendingTxs(ctx context.Context, c *wsConn, id string) {
+	ch := make(chan string, 128)
+	unsubscribe := s.pendingTxs.subscribe(ch)
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case hash := <-ch:
+			if err := c.notify(id, hash); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/hex"
+	"log"
+
+	"kortho/transaction"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/leveldb"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+)
+
+const (
+	ethHashPrefix    = "e" //ethHashPrefix + eth hash -> kortho hash
+	korthoHashPrefix = "k" //korthoHashPrefix + kortho hash -> eth hash
+	rawTxPrefix      = "r" //rawTxPrefix + eth hash -> raw transaction
+)
+
+// txHashIndex maps the ethereum hash of every raw transaction sent through
+// the gateway to the hash the kortho node accepted it under, and back.
+// Wallets only know the ethereum hash, while the node only knows its own.
+// The raw transaction is kept too, for the fields kortho does not store.
+type txHashIndex struct {
+	db ethdb.KeyValueStore
+}
+
+// newTxHashIndex opens the index stored in the leveldb directory path. An
+// empty path keeps the index in memory, which only tests use: the gateway
+// would forget every hash it mapped when restarted.
+func newTxHashIndex(path string) (*txHashIndex, error) {
+	if path == "" {
+		return &txHashIndex{db: memorydb.New()}, nil
+	}
+	db, err := leveldb.New(path, 16, 16, "", false)
+	if err != nil {
+		return nil, err
+	}
+	return &txHashIndex{db: db}, nil
+}
+
+func (ix *txHashIndex) put(ethHash common.Hash, korthoHash, raw []byte) error {
+	if err := ix.db.Put([]byte(rawTxPrefix+string(ethHash[:])), raw); err != nil {
+		return err
+	}
+	if err := ix.db.Put([]byte(ethHashPrefix+string(ethHash[:])), korthoHash); err != nil {
+		return err
+	}
+	return ix.db.Put([]byte(korthoHashPrefix+string(korthoHash)), ethHash[:])
+}
+
+func (ix *txHashIndex) korthoHash(ethHash common.Hash) ([]byte, bool) {
+	h, err := ix.db.Get([]byte(ethHashPrefix + string(ethHash[:])))
+	return h, err == nil
+}
+
+func (ix *txHashIndex) rawTx(ethHash common.Hash) ([]byte, bool) {
+	raw, err := ix.db.Get([]byte(rawTxPrefix + string(ethHash[:])))
+	return raw, err == nil
+}
+
+func (ix *txHashIndex) ethHash(korthoHash []byte) (common.Hash, bool) {
+	h, err := ix.db.Get([]byte(korthoHashPrefix + string(korthoHash)))
+	if err != nil {
+		return common.Hash{}, false
+	}
+	return common.BytesToHash(h), true
+}
+
+// indexTx records the kortho hash a raw transaction was accepted under.
+func (s *Server) indexTx(ethHash common.Hash, korthoHash string, raw []byte) {
+	kh, err := hex.DecodeString(strip0x(korthoHash))
+	if err != nil {
+		log.Println("indexTx invalid kortho hash:", korthoHash, err)
+		return
+	}
+	if err := s.txHashes.put(ethHash, kh, raw); err != nil {
+		log.Println("indexTx error:", err)
+	}
+}
+
+// korthoTxHash returns the kortho hash to query for a transaction hash given
+// in either form, hashes not in the index are passed on as they are.
+func (s *Server) korthoTxHash(hash string) string {
+	hash = strip0x(hash)
+	b, err := hex.DecodeString(hash)
+	if err != nil || len(b) != common.HashLength {
+		return hash
+	}
+	if kh, ok := s.txHashes.korthoHash(common.BytesToHash(b)); ok {
+		return hex.EncodeToString(kh)
+	}
+	return hash
+}
+
+// ethTxHash returns the ethereum hash reported for a kortho transaction.
+func (s *Server) ethTxHash(korthoHash []byte) common.Hash {
+	if h, ok := s.txHashes.ethHash(korthoHash); ok {
+		return h
+	}
+	return common.BytesToHash(korthoHash)
+}
+
+// ethTx returns the ethereum transaction a kortho transaction was sent as,
+// nil when it was not sent through the gateway.
+func (s *Server) ethTx(tx *transaction.Transaction) *types.Transaction {
+	h, ok := s.txHashes.ethHash(tx.Hash)
+	if !ok {
+		return nil
+	}
+	raw, ok := s.txHashes.rawTx(h)
+	if !ok {
+		return nil
+	}
+	var ethTx types.Transaction
+	if err := ethTx.UnmarshalBinary(raw); err != nil {
+		log.Println("ethTx invalid raw transaction:", h.Hex(), err)
+		return nil
+	}
+	return &ethTx
+}
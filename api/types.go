@@ -1,22 +1,114 @@
 package api
 
 import (
-	"errors"
-	"fmt"
+	"bytes"
+	"math/big"
 	"metamaskServer/client"
+	"time"
 
+	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
+	ethparams "github.com/ethereum/go-ethereum/params"
+	"github.com/gorilla/websocket"
 )
 
 var GASPRICE uint64 = 500000
 
+// MINGASPRICE is the gas price in kortho base units, reported in wei by
+// eth_gasPrice and as baseFeePerGas, and the least a transaction may offer.
+var MINGASPRICE uint64 = 21000
+
+const (
+	defaultBatchLimit       = 100
+	defaultMaxSubscriptions = 32
+	defaultPollInterval     = 2 * time.Second
+	defaultFilterTimeout    = 5 * time.Minute
+	defaultMaxFilters       = 64
+	defaultMaxFiltersTotal  = 4096
+	defaultDecimals         = 11
+	defaultLogsMaxRange     = 10000
+	defaultLogsMaxResults   = 10000
+	defaultLogsChunkSize    = 1000
+	defaultTxIndexPath      = "./data/txindex"
+
+	// shorter settings are raised to these, so a bare number read as
+	// nanoseconds cannot make the node be polled or filters swept in a
+	// busy loop
+	minPollInterval  = time.Second
+	minFilterTimeout = 2 * time.Second
+)
+
+// Config holds the server settings loaded from conf/config.yaml
+type Config struct {
+	RpcAddr    string //kortho node grpc address
+	ChainId    string
+	NetworkId  string
+	EthTo      string
+	BatchLimit int      //max requests in one batch, 0 means defaultBatchLimit
+	Namespaces []string //enabled api namespaces, empty means defaultNamespaces
+
+	MaxSubscriptions int           //max subscriptions per websocket connection
+	PollInterval     time.Duration //how often subscriptions poll the kortho node, at least 1s
+
+	FilterTimeout   time.Duration //idle filters are removed after this timeout, at least 2s
+	MaxFilters      int           //max installed filters per client
+	MaxFiltersTotal int           //max installed filters of all clients
+
+	TrustedProxies []string //proxy addresses whose X-Forwarded-For identifies the client
+
+	TxIndexPath string //leveldb directory of the eth/kortho tx hash index, defaults to ./data/txindex
+
+	RejectUnprotectedTxs bool //reject raw transactions without EIP-155 replay protection
+
+	Decimals int //decimals of the kortho native coin, 0 means defaultDecimals
+
+	KeystoreDir string //encrypted keystore of the managed accounts, empty means none
+
+	AllowInsecureUnlock bool //allow personal_unlockAccount, anyone reaching the gateway can then use unlocked accounts
+
+	WsOrigins []string //origins allowed to open websocket connections, "*" allows any, empty only the gateway's own host
+
+	LocalCalls  bool //execute eth_call on the gateway's EVM against the node's state, eth_estimateGas always is
+	VerifyCalls bool //compare local eth_call results with the node's and log differences
+
+	ErrorABIs []string //JSON ABI files whose custom errors are decoded in revert reasons
+
+	LogsMaxRange   uint64 //max blocks one eth_getLogs call spans, 0 means defaultLogsMaxRange
+	LogsMaxResults int    //max logs one eth_getLogs call returns, 0 means defaultLogsMaxResults
+	LogsChunkSize  uint64 //blocks per kortho node logs query, 0 means defaultLogsChunkSize
+}
+
 // Server struct
 type Server struct {
 	//r   *fasthttprouter.Router
-	cli       client.Client
-	chainId   string
-	networkId string
+	cli        client.Client
+	chainId    *big.Int
+	networkId  string
+	batchLimit int
+	methods    *registry
+
+	maxSubs        int
+	pollInterval   time.Duration
+	pendingTxs     hashFeed //hashes of transactions sent through the gateway
+	filters        *filterManager
+	trustedProxies map[string]bool
+	units          units
+	keystore       *keystore.KeyStore //nil when no keystore is configured
+	wsUpgrader     websocket.Upgrader
+	txHashes       *txHashIndex
+
+	rejectUnprotected   bool
+	allowInsecureUnlock bool
+	localCalls          bool
+	verifyCalls         bool
+	chainConfig         *ethparams.ChainConfig
+	errorABI            errorABI
+
+	logsMaxRange   uint64
+	logsMaxResults int
+	logsChunkSize  uint64
 }
 
 type params struct {
@@ -26,6 +118,13 @@ type params struct {
 	GasPrice string `json:"gasPrice"`
 	Value    string `json:"value"`
 	Data     string `json:"data"`
+	Nonce    string `json:"nonce"`
+}
+
+// SignTransactionResult is the signed transaction returned by eth_signTransaction.
+type SignTransactionResult struct {
+	Raw hexutil.Bytes      `json:"raw"`
+	Tx  *types.Transaction `json:"tx"`
 }
 
 type responseBody struct {
@@ -34,6 +133,17 @@ type responseBody struct {
 	Result  interface{} `json:"result"`
 }
 
+type subscriptionResult struct {
+	Subscription string      `json:"subscription"`
+	Result       interface{} `json:"result"`
+}
+
+type subscriptionNotification struct {
+	JsonRPC string             `json:"jsonrpc"`
+	Method  string             `json:"method"`
+	Params  subscriptionResult `json:"params"`
+}
+
 type responseErr struct {
 	JsonRPC string      `json:"jsonrpc"`
 	Id      interface{} `json:"id"`
@@ -41,85 +151,90 @@ type responseErr struct {
 }
 
 type ErrorBody struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
-	Data    string `json:"data"`
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
 }
 
+// Transaction is an ethereum transaction object. The fee fields, access list
+// and chain id are those of the transaction type.
 type Transaction struct {
-	BlockHash        string `json:"blockHash"`
-	BlockNumber      string `json:"blockNumber"`
-	From             string `json:"from"`
-	Gas              string `json:"gas"`
-	GasPrice         string `json:"gasPrice"`
-	Hash             string `json:"hash"`
-	Input            string `json:"input"`
-	Nonce            string `json:"nonce"`
-	To               string `json:"to"`
-	TransactionIndex string `json:"transactionIndex"`
-	Value            string `json:"value"`
-	V                string `json:"v"`
-	R                string `json:"r"`
-	S                string `json:"S"`
-}
-
-type responseTransaction struct {
-	JsonRPC string       `json:"jsonrpc"`
-	Id      interface{}  `json:"id"`
-	Result  *Transaction `json:"result"`
+	BlockHash        common.Hash       `json:"blockHash"`
+	BlockNumber      hexutil.Uint64    `json:"blockNumber"`
+	From             common.Address    `json:"from"`
+	Gas              hexutil.Uint64    `json:"gas"`
+	GasPrice         *hexutil.Big      `json:"gasPrice"`
+	GasFeeCap        *hexutil.Big      `json:"maxFeePerGas,omitempty"`
+	GasTipCap        *hexutil.Big      `json:"maxPriorityFeePerGas,omitempty"`
+	Hash             common.Hash       `json:"hash"`
+	Input            hexutil.Bytes     `json:"input"`
+	Nonce            hexutil.Uint64    `json:"nonce"`
+	To               *common.Address   `json:"to"`
+	TransactionIndex hexutil.Uint64    `json:"transactionIndex"`
+	Value            *hexutil.Big      `json:"value"`
+	Type             hexutil.Uint64    `json:"type"`
+	Accesses         *types.AccessList `json:"accessList,omitempty"`
+	ChainID          *hexutil.Big      `json:"chainId,omitempty"`
+	V                *hexutil.Big      `json:"v"`
+	R                *hexutil.Big      `json:"r"`
+	S                *hexutil.Big      `json:"s"`
 }
 
+// TransactionReceipt is an ethereum receipt object. ContractAddress is only
+// set for contract creations, whose To is null.
 type TransactionReceipt struct {
-	BlockHash         common.Hash    `json:"blockHash"`
-	BlockNumber       uint64         `json:"blockNumber"`
-	ContractAddress   common.Address `json:"contractAddress"`
-	CumulativeGasUsed uint64         `json:"cumulativeGasUsed"`
-	From              common.Address `json:"from"`
-	GasUsed           uint64         `json:"gasUsed"`
-	Logs              []*types.Log   `json:"logs"` //[]*types.Log
-	LogsBloom         types.Bloom    `json:"logsBloom"`
-	Status            uint64         `json:"status"`
-	To                common.Address `json:"to"`
-
-	TransactionHash  common.Hash `json:"transactionHash"`
-	TransactionIndex uint        `json:"transactionIndex"`
-
-	Root common.Hash `json:"root"`
-}
-
-type responseReceipt struct {
-	JsonRPC string              `json:"jsonrpc"`
-	Id      interface{}         `json:"id"`
-	Result  *TransactionReceipt `json:"result"`
+	BlockHash         common.Hash     `json:"blockHash"`
+	BlockNumber       hexutil.Uint64  `json:"blockNumber"`
+	ContractAddress   *common.Address `json:"contractAddress"`
+	CumulativeGasUsed hexutil.Uint64  `json:"cumulativeGasUsed"`
+	EffectiveGasPrice *hexutil.Big    `json:"effectiveGasPrice"`
+	From              common.Address  `json:"from"`
+	GasUsed           hexutil.Uint64  `json:"gasUsed"`
+	Logs              []*types.Log    `json:"logs"`
+	LogsBloom         types.Bloom     `json:"logsBloom"`
+	Status            hexutil.Uint64  `json:"status"`
+	To                *common.Address `json:"to"`
+	TransactionHash   common.Hash     `json:"transactionHash"`
+	TransactionIndex  hexutil.Uint64  `json:"transactionIndex"`
+	Type              hexutil.Uint64  `json:"type"`
 }
 
+// Block is an ethereum block object, Transactions holds either the
+// transaction hashes or full Transaction objects.
 type Block struct {
-	Difficulty string         `json:"difficulty"`
-	ExtraData  string         `json:"extraData"`
-	GasLimit   string         `json:"gasLimit"`
-	GasUsed    string         `json:"gasUsed"`
-	Hash       string         `json:"hash"`
-	LogsBloom  string         `json:"logsBloom"`
-	Miner      common.Address `json:"miner"`
-	MixHash    string         `json:"mixHash"`
-	Nonce      string         `json:"nonce"`
-	Number     string         `json:"number"`
-	ParentHash string         `json:"parentHash"`
-	TimeStamp  string         `json:"timestamp"`
-}
-
-type responseBlock struct {
-	JsonRPC string      `json:"jsonrpc"`
-	Id      interface{} `json:"id"`
-	Result  *Block      `json:"result"`
+	BaseFeePerGas    *hexutil.Big     `json:"baseFeePerGas"`
+	Difficulty       *hexutil.Big     `json:"difficulty"`
+	ExtraData        hexutil.Bytes    `json:"extraData"`
+	GasLimit         hexutil.Uint64   `json:"gasLimit"`
+	GasUsed          hexutil.Uint64   `json:"gasUsed"`
+	Hash             common.Hash      `json:"hash"`
+	LogsBloom        types.Bloom      `json:"logsBloom"`
+	Miner            common.Address   `json:"miner"`
+	MixHash          common.Hash      `json:"mixHash"`
+	Nonce            types.BlockNonce `json:"nonce"`
+	Number           hexutil.Uint64   `json:"number"`
+	ParentHash       common.Hash      `json:"parentHash"`
+	ReceiptsRoot     common.Hash      `json:"receiptsRoot"`
+	Sha3Uncles       common.Hash      `json:"sha3Uncles"`
+	Size             hexutil.Uint64   `json:"size"`
+	StateRoot        common.Hash      `json:"stateRoot"`
+	TimeStamp        hexutil.Uint64   `json:"timestamp"`
+	TotalDifficulty  *hexutil.Big     `json:"totalDifficulty"`
+	Transactions     []interface{}    `json:"transactions"`
+	TransactionsRoot common.Hash      `json:"transactionsRoot"`
+	Uncles           []common.Hash    `json:"uncles"`
 }
 
+// reqGetLog is a log filter. A log matches when it was emitted by one of
+// Addresses, any address when empty, and its topics match Topics by position:
+// each position lists the alternatives it accepts, an empty list or a
+// position past the end of Topics accepts any topic.
 type reqGetLog struct {
-	FromBlock string   `json:"fromBlock"`
-	ToBlock   string   `json:"toBlock"`
-	Address   string   `json:"address"`
-	Topics    []string `json:"topics"`
-	BlockHash string   `json:"blockhash"`
+	FromBlock *BlockNumber     `json:"fromBlock"`
+	ToBlock   *BlockNumber     `json:"toBlock"`
+	Addresses []common.Address `json:"address"`
+	Topics    [][]common.Hash  `json:"topics"`
+	BlockHash string           `json:"blockHash"`
 }
 
 type resGetLogs struct {
@@ -134,11 +249,12 @@ type resGetLogs struct {
 }
 
 var (
-	PRI                       string = "3DqKDKADdhWgdvpNgx1JJpFBx8fkvxEKNFeTkihJ3Xgwue3qRjq6R5JcPTdvZ5PEPjC9JaRLgPhhGPAQkoCYreV"
 	ETH_CHAINID               string = "eth_chainId"
 	NET_VERSION               string = "net_version"
 	ETH_SENDTRANSACTION       string = "eth_sendTransaction"
 	ETH_CALL                  string = "eth_call"
+	ETH_CALLMANY              string = "eth_callMany"
+	ETH_SIMULATEV1            string = "eth_simulateV1"
 	ETH_BLOCKNUMBER           string = "eth_blockNumber"
 	ETH_GETBALANCE            string = "eth_getBalance"
 	ETH_GETBLOCKBYHASH        string = "eth_getBlockByHash"
@@ -153,38 +269,31 @@ var (
 	ETH_GETLOGS               string = "eth_getLogs"
 	ETH_GETSTORAGEAT          string = "eth_getStorageAt"
 	ETH_SIGNTRANSACTION       string = "eth_signTransaction"
+	ETH_SUBSCRIBE             string = "eth_subscribe"
+	ETH_UNSUBSCRIBE           string = "eth_unsubscribe"
+	ETH_SUBSCRIPTION          string = "eth_subscription"
 
-	WEB3_CLIENTVERSION string = "web3_clientVersion"
-)
-
-func getString(mp map[string]interface{}, k string) (string, error) {
-	v, ok := mp[k]
-	if !ok {
-		return "", errors.New(fmt.Sprintf("'%s' not exist", k))
-	}
-	if s, ok := v.(string); ok {
-		return s, nil
-	}
-	return "", errors.New(fmt.Sprintf("'%s' not string", k))
-}
+	ETH_NEWFILTER                   string = "eth_newFilter"
+	ETH_NEWBLOCKFILTER              string = "eth_newBlockFilter"
+	ETH_NEWPENDINGTRANSACTIONFILTER string = "eth_newPendingTransactionFilter"
+	ETH_GETFILTERCHANGES            string = "eth_getFilterChanges"
+	ETH_GETFILTERLOGS               string = "eth_getFilterLogs"
+	ETH_UNINSTALLFILTER             string = "eth_uninstallFilter"
 
-func getValue(mp map[string]interface{}, k string) (interface{}, error) {
-	v, ok := mp[k]
-	if !ok {
-		return 0, errors.New(fmt.Sprintf("'%s' not exist", k))
-	}
-	//log.Printf("value type %T,value:%v\n", v, v)
-	return v, nil
-}
+	ETH_ACCOUNTS           string = "eth_accounts"
+	PERSONAL_NEWACCOUNT    string = "personal_newAccount"
+	PERSONAL_UNLOCKACCOUNT string = "personal_unlockAccount"
+	PERSONAL_LOCKACCOUNT   string = "personal_lockAccount"
+	ETH_SIGN               string = "eth_sign"
+	ETH_SIGNTYPEDDATA_V4   string = "eth_signTypedData_v4"
+	PERSONAL_SIGN          string = "personal_sign"
+	PERSONAL_ECRECOVER     string = "personal_ecRecover"
 
-func getParam(mp map[string]interface{}) (string, error) {
-	v, ok := mp["params"]
-	if !ok {
-		return "", errors.New(fmt.Sprintf("'%s' not exist", "params"))
-	}
+	WEB3_CLIENTVERSION string = "web3_clientVersion"
+)
 
-	if para, ok := v.([]interface{}); ok {
-		return para[0].(string), nil
-	}
-	return "", errors.New("get params failed.")
+// isBatch reports whether the request body is a JSON array.
+func isBatch(body []byte) bool {
+	b := bytes.TrimLeft(body, " \t\r\n")
+	return len(b) > 0 && b[0] == '['
 }
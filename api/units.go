@@ -0,0 +1,101 @@
+package api
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// weiDecimals is the number of decimals wallets assume for the native coin.
+const weiDecimals = 18
+
+// units converts native amounts between the kortho base unit, which has the
+// configured number of decimals, and wei. Every amount crossing the gateway
+// goes through it: kortho amounts are scaled up on the way out, and wei
+// amounts are scaled down on the way in, failing instead of truncating when
+// the wei amount has more precision than kortho can represent.
+type units struct {
+	decimals int
+	factor   *big.Int //wei per kortho base unit
+}
+
+func newUnits(decimals int) units {
+	exp := big.NewInt(int64(weiDecimals - decimals))
+	return units{decimals: decimals, factor: new(big.Int).Exp(big.NewInt(10), exp, nil)}
+}
+
+// toWei converts a kortho amount to wei.
+func (u units) toWei(amount *big.Int) *hexutil.Big {
+	return (*hexutil.Big)(new(big.Int).Mul(amount, u.factor))
+}
+
+// uint64ToWei converts a kortho amount held in a uint64 field to wei.
+func (u units) uint64ToWei(amount uint64) *hexutil.Big {
+	return u.toWei(new(big.Int).SetUint64(amount))
+}
+
+// fromWei converts a wei amount to kortho base units. Kortho transactions
+// hold their amount in a uint64, larger amounts are rejected.
+func (u units) fromWei(wei *big.Int) (*big.Int, error) {
+	if wei.Sign() < 0 {
+		return nil, invalidParams("negative amount %v", wei)
+	}
+	amount, rem := new(big.Int).QuoRem(wei, u.factor, new(big.Int))
+	if rem.Sign() != 0 {
+		return nil, invalidParams("amount %v wei loses precision, kortho amounts have %v decimals", wei, u.decimals)
+	}
+	if !amount.IsUint64() {
+		return nil, invalidParams("amount %v wei too large", wei)
+	}
+	return amount, nil
+}
+
+// minGasPrice returns MINGASPRICE in wei.
+func (u units) minGasPrice() *big.Int {
+	return u.uint64ToWei(MINGASPRICE).ToInt()
+}
+
+// checkGasPrice validates a gas price or fee cap offered in wei. Like amounts
+// it has to convert to kortho base units without losing precision, and it
+// has to cover MINGASPRICE.
+func (u units) checkGasPrice(price *big.Int) error {
+	kto, err := u.fromWei(price)
+	if err != nil {
+		return err
+	}
+	if kto.Cmp(new(big.Int).SetUint64(MINGASPRICE)) < 0 {
+		return invalidParams("gas price %v wei is below the minimum of %v wei", price, u.minGasPrice())
+	}
+	return nil
+}
+
+// effectiveGasPrice returns the gas price in wei a transaction pays per gas.
+// Fee market transactions pay the base fee plus their tip, capped by their
+// fee cap. Transactions the gateway has no raw form of pay MINGASPRICE.
+func (u units) effectiveGasPrice(tx *types.Transaction) *big.Int {
+	if tx == nil {
+		return u.minGasPrice()
+	}
+	if tx.Type() != types.DynamicFeeTxType {
+		return tx.GasPrice()
+	}
+	price := new(big.Int).Add(tx.GasTipCap(), u.minGasPrice())
+	if price.Cmp(tx.GasFeeCap()) > 0 {
+		price = tx.GasFeeCap()
+	}
+	return price
+}
+
+// parseWei converts a hex encoded wei amount to kortho base units, an empty
+// amount is zero.
+func (u units) parseWei(hex string) (*big.Int, error) {
+	if hex == "" {
+		return new(big.Int), nil
+	}
+	wei, err := hexutil.DecodeBig(hex)
+	if err != nil {
+		return nil, invalidParams("invalid amount %q: %v", hex, err)
+	}
+	return u.fromWei(wei)
+}
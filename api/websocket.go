@@ -0,0 +1,157 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsReadLimit    = 15 * 1024 * 1024
+	wsPingInterval = 30 * time.Second
+	wsWriteWait    = 10 * time.Second
+	wsMaxInFlight  = 16 //requests of one connection served at the same time
+)
+
+// newWsUpgrader returns the upgrader accepting websocket connections from
+// origins. Without origins only requests of the gateway's own host or
+// without an Origin header are accepted, "*" accepts any origin.
+func newWsUpgrader(origins []string) websocket.Upgrader {
+	u := websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
+	if len(origins) == 0 {
+		return u //gorilla checks the origin against the host
+	}
+	allowed := make(map[string]bool)
+	for _, origin := range origins {
+		allowed[strings.ToLower(strings.TrimSpace(origin))] = true
+	}
+	u.CheckOrigin = func(req *http.Request) bool {
+		origin := req.Header.Get("Origin")
+		return origin == "" || allowed["*"] || allowed[strings.ToLower(origin)]
+	}
+	return u
+}
+
+// connKey is the context key of the websocket connection serving a request.
+type connKey struct{}
+
+// wsConn is a websocket client connection with its active subscriptions.
+type wsConn struct {
+	conn *websocket.Conn
+	wmu  sync.Mutex //serializes writes
+
+	mu   sync.Mutex
+	subs map[string]context.CancelFunc
+}
+
+// connFromContext returns the websocket connection of a request, if any.
+func connFromContext(ctx context.Context) (*wsConn, bool) {
+	c, ok := ctx.Value(connKey{}).(*wsConn)
+	return c, ok
+}
+
+// HandWebsocket serves JSON-RPC over a websocket connection using the same
+// method registry as HandRequest. Subscriptions live until they are
+// unsubscribed or the connection is closed.
+func (s *Server) HandWebsocket(w http.ResponseWriter, req *http.Request) {
+	conn, err := s.wsUpgrader.Upgrade(w, req, nil)
+	if err != nil {
+		log.Println("websocket Upgrade error:", err)
+		return
+	}
+	defer conn.Close()
+	conn.SetReadLimit(wsReadLimit)
+	log.Println("websocket connected:", req.RemoteAddr)
+
+	c := &wsConn{conn: conn, subs: make(map[string]context.CancelFunc)}
+	ctx := context.WithValue(context.Background(), clientKey{}, s.clientAddr(req))
+	ctx, cancel := context.WithCancel(context.WithValue(ctx, connKey{}, c))
+	defer cancel()
+	go c.ping(ctx)
+
+	// reading stops while wsMaxInFlight requests are being served
+	inFlight := make(chan struct{}, wsMaxInFlight)
+	for {
+		_, body, err := conn.ReadMessage()
+		if err != nil {
+			log.Println("websocket closed:", req.RemoteAddr, err)
+			return
+		}
+		inFlight <- struct{}{}
+		go func() {
+			defer func() { <-inFlight }()
+			s.handWsMessage(ctx, c, body)
+		}()
+	}
+}
+
+func (s *Server) handWsMessage(ctx context.Context, c *wsConn, body []byte) {
+	if isBatch(body) {
+		var buf bytes.Buffer
+		s.handBatch(ctx, &buf, body)
+		if buf.Len() > 0 {
+			c.write(buf.Bytes())
+		}
+		return
+	}
+
+	var msg jsonrpcMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		c.write(errResponse("", nil, newRPCError(ErrCodeParse, "parse error: %v", err)))
+		return
+	}
+	if resp := s.handleMsg(ctx, &msg); resp != nil {
+		c.write(resp)
+	}
+}
+
+func (c *wsConn) write(msg []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	err := c.conn.WriteMessage(websocket.TextMessage, msg)
+	if err != nil {
+		log.Println("websocket write error:", err)
+	}
+	return err
+}
+
+// notify sends a subscription notification.
+func (c *wsConn) notify(id string, result interface{}) error {
+	msg, err := json.Marshal(subscriptionNotification{
+		JsonRPC: "2.0",
+		Method:  ETH_SUBSCRIPTION,
+		Params:  subscriptionResult{Subscription: id, Result: result},
+	})
+	if err != nil {
+		log.Println("notify Marshal error:", err)
+		return err
+	}
+	return c.write(msg)
+}
+
+// ping keeps idle connections alive through proxies.
+func (c *wsConn) ping(ctx context.Context) {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.wmu.Lock()
+			err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait))
+			c.wmu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWebsocketSubscribeNewHeads(t *testing.T) {
+	cli := &fakeClient{height: 5}
+	s := newServer(cli, &Config{ChainId: "0x1"})
+	s.pollInterval = 10 * time.Millisecond //below what the config allows
+	ts := httptest.NewServer(http.HandlerFunc(s.HandRequest))
+	defer ts.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":1,"method":"eth_subscribe","params":["newHeads"]}`)); err != nil {
+		t.Fatal(err)
+	}
+	var resp struct {
+		Id     int    `json:"id"`
+		Result string `json:"result"`
+	}
+	if err := conn.ReadJSON(&resp); err != nil || resp.Result == "" {
+		t.Fatalf("subscribe failed: %v %v", err, resp)
+	}
+
+	cli.setHeight(6)
+	var note subscriptionNotification
+	if err := conn.ReadJSON(&note); err != nil {
+		t.Fatal(err)
+	}
+	if note.Method != ETH_SUBSCRIPTION || note.Params.Subscription != resp.Result {
+		t.Fatalf("unexpected notification: %v", note)
+	}
+	head, _ := json.Marshal(note.Params.Result)
+	if !strings.Contains(string(head), `"number":"0x6"`) {
+		t.Errorf("unexpected head: %s", head)
+	}
+}
+
+func TestWebsocketOrigins(t *testing.T) {
+	for _, tt := range []struct {
+		origins []string
+		origin  string
+		ok      bool
+	}{
+		{nil, "", true},
+		{nil, "http://evil.example", false},
+		{[]string{"https://wallet.example"}, "https://Wallet.example", true},
+		{[]string{"https://wallet.example"}, "http://evil.example", false},
+		{[]string{"*"}, "http://evil.example", true},
+	} {
+		s := newServer(&fakeClient{}, &Config{ChainId: "0x1", WsOrigins: tt.origins})
+		ts := httptest.NewServer(http.HandlerFunc(s.HandRequest))
+		header := http.Header{}
+		if tt.origin != "" {
+			header.Set("Origin", tt.origin)
+		}
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), header)
+		if (err == nil) != tt.ok {
+			t.Errorf("origins %v, origin %q: got %v", tt.origins, tt.origin, err)
+		}
+		if conn != nil {
+			conn.Close()
+		}
+		ts.Close()
+	}
+}
+
+func TestSubscribeOverHTTP(t *testing.T) {
+	res := doRequest(newTestServer(), `{"jsonrpc":"2.0","id":1,"method":"eth_subscribe","params":["newHeads"]}`)
+	if !strings.Contains(res, "notifications not supported") {
+		t.Errorf("expected notifications not supported, got %s", res)
+	}
+}
+
+func TestHashFeedDoesNotBlock(t *testing.T) {
+	var feed hashFeed
+	stuck, live := make(chan string, 1), make(chan string, 4)
+	feed.subscribe(stuck)
+	unsubscribe := feed.subscribe(live)
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 3; i++ {
+			feed.send(string(rune('a' + i)))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("send blocked on a full subscriber")
+	}
+	if len(stuck) != 1 || len(live) != 3 {
+		t.Errorf("got %d and %d hashes, want 1 and 3", len(stuck), len(live))
+	}
+
+	unsubscribe()
+	feed.send("d")
+	if len(live) != 3 {
+		t.Errorf("unsubscribed channel got a hash")
+	}
+}
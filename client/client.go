@@ -10,33 +10,42 @@ import (
 	"kortho/block"
 	"kortho/transaction"
 	"log"
+	"math/big"
 
 	//"metamaskServer/api"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/core/vm"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type client struct {
-	cli   message.GreeterClient
-	ethTo string
+	cli     message.GreeterClient
+	ethTo   string
+	chainId *big.Int
 }
 
-func New(addr, ethT string) *client {
-	log.Println("New client:", addr, ethT)
+func New(addr, ethT string, chainId *big.Int) *client {
+	log.Println("New client:", addr, ethT, chainId)
 	conn, err := grpc.Dial(addr, grpc.WithInsecure(), grpc.WithBlock())
 	if err != nil {
 		return nil
 	}
 	return &client{
-		cli:   message.NewGreeterClient(conn),
-		ethTo: ethT,
+		cli:     message.NewGreeterClient(conn),
+		ethTo:   ethT,
+		chainId: chainId,
 	}
 }
 
-func (c *client) SendTransaction(from, to, priv string, amount uint64) (string, error) {
+func (c *client) SendTransaction(from, to, priv string, amount *big.Int) (string, error) {
+	if amount.Sign() < 0 || !amount.IsUint64() {
+		return "", status.Errorf(codes.InvalidArgument, "amount %v out of range", amount)
+	}
 	resFrom, err := c.cli.GetKTOAddress(context.Background(), &message.ReqEthAddress{Ethaddress: from})
 	if err != nil {
 		return "", err
@@ -53,7 +62,7 @@ func (c *client) SendTransaction(from, to, priv string, amount uint64) (string,
 	var req message.ReqTransaction
 	req.From = resFrom.Ktoaddress
 	req.To = resTo.Ktoaddress
-	req.Amount = amount
+	req.Amount = amount.Uint64()
 	req.Nonce = n.Nonce
 	req.Priv = priv
 	resp, err := c.cli.SendTransaction(context.Background(), &req)
@@ -91,12 +100,22 @@ func (c *client) ContractCall(origin string, contractAddr string, callInput stri
 	}
 
 	if len(resp.Msg) > 0 {
-		return resp.Result, errors.New(resp.Msg)
+		return resp.Result, contractCallError(resp.Msg)
 	}
 
 	return resp.Result, nil
 }
 
+// contractCallError converts the message of a failed contract call. The node
+// reports a revert with the message of vm.ErrExecutionReverted, which is
+// returned as that error so the revert data is decoded.
+func contractCallError(msg string) error {
+	if msg == vm.ErrExecutionReverted.Error() {
+		return vm.ErrExecutionReverted
+	}
+	return errors.New(msg)
+}
+
 func (c *client) GetBlockNumber() (uint64, error) {
 	num, err := c.cli.GetMaxBlockNumber(context.Background(), &message.ReqMaxBlockNumber{})
 	if err != nil {
@@ -106,18 +125,18 @@ func (c *client) GetBlockNumber() (uint64, error) {
 	return num.MaxNumber, nil
 }
 
-func (c *client) GetBalance(from string) (uint64, error) {
+func (c *client) GetBalance(from string) (*big.Int, error) {
 	res, err := c.cli.GetKTOAddress(context.Background(), &message.ReqEthAddress{Ethaddress: from})
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	num, err := c.cli.GetBalance(context.Background(), &message.ReqBalance{Address: res.Ktoaddress})
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	log.Println("GetBalance from KTOAddress", res.Ktoaddress, "balance=", num.Balnce)
-	return num.Balnce, nil
+	return new(big.Int).SetUint64(num.Balnce), nil
 }
 
 func (c *client) GetBlockByHash(hash string) (*block.Block, error) {
@@ -126,7 +145,7 @@ func (c *client) GetBlockByHash(hash string) (*block.Block, error) {
 		return nil, err
 	}
 	if resp.Code != 0 {
-		return nil, fmt.Errorf("GetBlockByHash error: hash=%v,Code = %v,%v", hash, resp.Code, resp.Message)
+		return nil, lookupError("GetBlockByHash", hash, resp.Code, resp.Message)
 	}
 
 	return bftnode.BlockConversion(resp.Data)
@@ -138,7 +157,7 @@ func (c *client) GetBlockByNumber(num uint64) (*block.Block, error) {
 		return nil, err
 	}
 	if resp.Code != 0 {
-		return nil, fmt.Errorf("GetBlockByNumber error: number=%v,Code = %v,%v", num, resp.Code, resp.Message)
+		return nil, lookupError("GetBlockByNumber", num, resp.Code, resp.Message)
 	}
 
 	return bftnode.BlockConversion(resp.Data)
@@ -150,11 +169,18 @@ func (c *client) GetTransactionByHash(hash string) (*transaction.Transaction, er
 		return nil, err
 	}
 	if resp.Code != 0 {
-		return nil, fmt.Errorf("GetTransactionByHash error: hash=%v,Code = %v,%v", hash, resp.Code, resp.Message)
+		return nil, lookupError("GetTransactionByHash", hash, resp.Code, resp.Message)
 	}
 	return kapi.MsgTxToTx(resp.Data)
 }
 
+// lookupError reports a non-zero Code of a block or transaction lookup. The
+// node answers unknown hashes and numbers, and transactions that are not in a
+// block yet, with such a code, so it is returned as a NotFound status.
+func lookupError(method string, key interface{}, code int32, msg string) error {
+	return status.Errorf(codes.NotFound, "%s error: %v,Code = %v,%v", method, key, code, msg)
+}
+
 func (c *client) GetCode(contractAddr string) (string, error) {
 	resp, err := c.cli.GetCode(context.Background(), &message.ReqEvmGetcode{Addr: contractAddr})
 	if err != nil {
@@ -177,25 +203,41 @@ func (c *client) GetNonce(addr string) (uint64, error) {
 	return resp.Nonce, nil
 }
 
-func (c *client) SendRawTransaction(rawTx string) (string, error) {
+// decodeRawTx decodes a legacy or EIP-2718 typed transaction and recovers
+// its sender. The kortho node executes the sender, recipient, value and data
+// of the transaction and charges its own fixed fee, so the gas price of legacy
+// and access list transactions and the maxFeePerGas/maxPriorityFeePerGas of
+// dynamic fee transactions are not used. Access lists are accepted but have
+// no effect on the kortho EVM.
+func decodeRawTx(rawTx string, chainId *big.Int) (*types.Transaction, common.Address, error) {
 	decTX, err := hexutil.Decode(rawTx)
 	if err != nil {
-		log.Fatal("hexutil Decode error:", err)
-		return "", err
+		return nil, common.Address{}, status.Errorf(codes.InvalidArgument, "invalid raw transaction: %v", err)
 	}
 	var tx types.Transaction
-	err = rlp.DecodeBytes(decTX, &tx)
+	if err := tx.UnmarshalBinary(decTX); err != nil {
+		return nil, common.Address{}, status.Errorf(codes.InvalidArgument, "invalid raw transaction: %v", err)
+	}
+	switch tx.Type() {
+	case types.LegacyTxType, types.AccessListTxType, types.DynamicFeeTxType:
+	default:
+		return nil, common.Address{}, status.Errorf(codes.InvalidArgument, "transaction type %d not supported", tx.Type())
+	}
+
+	sender, err := types.Sender(types.NewLondonSigner(chainId), &tx)
 	if err != nil {
-		log.Fatal("DecodeBytes error:", err)
-		return "", err
+		return nil, common.Address{}, status.Errorf(codes.InvalidArgument, "invalid sender: %v", err)
 	}
+	return &tx, sender, nil
+}
 
-	signer := types.NewEIP155Signer(tx.ChainId())
-	sender, err := signer.Sender(&tx)
+func (c *client) SendRawTransaction(rawTx string) (string, error) {
+	tx, sender, err := decodeRawTx(rawTx, c.chainId)
 	if err != nil {
-		log.Fatal("signer.Sender error:", err)
+		log.Println("decodeRawTx error:", err)
+		return "", err
 	}
-	log.Printf("tx params:{sender:%v,to:%v,amount:%v,nounce:%v,hash:%v,gas:%v,gasPrice:%v}\n", sender, tx.To(), tx.Value(), tx.Nonce(), tx.Hash(), tx.Gas(), tx.GasPrice())
+	log.Printf("tx params:{type:%v,sender:%v,to:%v,amount:%v,nounce:%v,hash:%v,gas:%v,gasFeeCap:%v,gasTipCap:%v,accessList:%v}\n", tx.Type(), sender, tx.To(), tx.Value(), tx.Nonce(), tx.Hash(), tx.Gas(), tx.GasFeeCap(), tx.GasTipCap(), len(tx.AccessList()))
 
 	dl := len(tx.Data())
 	log.Printf("data lenght====%v\n:", dl)
@@ -240,7 +282,7 @@ func (c *client) GetTransactionReceipt(hash string) (*transaction.Transaction, e
 		return nil, err
 	}
 	if resp.Code != 0 {
-		return nil, fmt.Errorf("GetTransactionReceipt error: hash=%v,Code = %v,%v", hash, resp.Code, resp.Message)
+		return nil, lookupError("GetTransactionReceipt", hash, resp.Code, resp.Message)
 	}
 	tx := resp.Data
 	if tx.Evm != nil {
@@ -2,18 +2,30 @@ package client
 
 import (
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
+	"math/big"
 	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+var testChainId = big.NewInt(8285)
+
 func TestSendSignedTransaction(t *testing.T) {
-	cli := New("106.12.186.114:6001", "0x60a17Ef1B8b22e89cd6d19bcCD275863d98F2091")
+	cli := New("106.12.186.114:6001", "0x60a17Ef1B8b22e89cd6d19bcCD275863d98F2091", testChainId)
 	from := "0x4790B510972A9826Ebc54592cF6d4C680Ae61A67"
 	to := "0x6EDe43322872D37c6B578AC490109feCd4a7A528"
 	pri := "2XM9Roy8Grg4vSr8PJ5ufgYCoKL9eV4V8VdevGv6ufAnEkezzyBzzjUa4UHsWhMXLh2g2wRyrUagggkZWkrm2bzh"
 	amount := 500000
-	s, err := cli.SendTransaction(from, to, pri, uint64(amount))
+	s, err := cli.SendTransaction(from, to, pri, big.NewInt(int64(amount)))
 	if err != nil {
 		t.Error(err)
 		return
@@ -21,8 +33,33 @@ func TestSendSignedTransaction(t *testing.T) {
 	t.Log(s)
 }
 
+func TestSendTransactionAmountRange(t *testing.T) {
+	cli := &client{chainId: testChainId}
+	for _, amount := range []*big.Int{big.NewInt(-1), new(big.Int).Lsh(big.NewInt(1), 64)} {
+		_, err := cli.SendTransaction("0x4790B510972A9826Ebc54592cF6d4C680Ae61A67", "0x6EDe43322872D37c6B578AC490109feCd4a7A528", "", amount)
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("amount %v: expected invalid argument, got %v", amount, err)
+		}
+	}
+}
+
+func TestLookupError(t *testing.T) {
+	if err := lookupError("GetTransactionByHash", "00", 1, "NotExist"); status.Code(err) != codes.NotFound {
+		t.Errorf("expected not found, got %v", err)
+	}
+}
+
+func TestContractCallError(t *testing.T) {
+	if err := contractCallError("execution reverted"); !errors.Is(err, vm.ErrExecutionReverted) {
+		t.Errorf("expected a revert, got %v", err)
+	}
+	if err := contractCallError("revert of state failed"); errors.Is(err, vm.ErrExecutionReverted) {
+		t.Errorf("expected a plain error, got %v", err)
+	}
+}
+
 func TestGetBlockNumber(t *testing.T) {
-	cli := New("106.12.186.114:6001", "0x60a17Ef1B8b22e89cd6d19bcCD275863d98F2091")
+	cli := New("106.12.186.114:6001", "0x60a17Ef1B8b22e89cd6d19bcCD275863d98F2091", testChainId)
 
 	height, err := cli.GetBlockNumber()
 	if err != nil {
@@ -33,7 +70,7 @@ func TestGetBlockNumber(t *testing.T) {
 }
 
 func TestGetBalance(t *testing.T) {
-	cli := New("106.12.186.114:6001", "0x60a17Ef1B8b22e89cd6d19bcCD275863d98F2091")
+	cli := New("106.12.186.114:6001", "0x60a17Ef1B8b22e89cd6d19bcCD275863d98F2091", testChainId)
 	from := "0x4790B510972A9826Ebc54592cF6d4C680Ae61A67"
 	banl, err := cli.GetBalance(from)
 	if err != nil {
@@ -44,7 +81,7 @@ func TestGetBalance(t *testing.T) {
 }
 
 func TestGetBlockByHash(t *testing.T) {
-	cli := New("106.12.186.114:6001", "0x60a17Ef1B8b22e89cd6d19bcCD275863d98F2091")
+	cli := New("106.12.186.114:6001", "0x60a17Ef1B8b22e89cd6d19bcCD275863d98F2091", testChainId)
 	hash := "KtoGtNKGkYTZmLo22ngPj7ZNz7Ufi1ktRFo6S64aZb7nMc5"
 
 	b, err := cli.GetBlockByHash(hash)
@@ -56,7 +93,7 @@ func TestGetBlockByHash(t *testing.T) {
 }
 
 func TestGetBlockByNumber(t *testing.T) {
-	cli := New("106.12.186.114:6001", "0x60a17Ef1B8b22e89cd6d19bcCD275863d98F2091")
+	cli := New("106.12.186.114:6001", "0x60a17Ef1B8b22e89cd6d19bcCD275863d98F2091", testChainId)
 	var num uint64 = 2403730
 	b, err := cli.GetBlockByNumber(num)
 	if err != nil {
@@ -67,7 +104,7 @@ func TestGetBlockByNumber(t *testing.T) {
 }
 
 func TestGetTransactionByHash(t *testing.T) {
-	cli := New("106.12.186.114:6001", "0x60a17Ef1B8b22e89cd6d19bcCD275863d98F2091")
+	cli := New("106.12.186.114:6001", "0x60a17Ef1B8b22e89cd6d19bcCD275863d98F2091", testChainId)
 	hash := "d9aa743f6cf8dbdd220dd9fcab0cebf18f001ce5381168f60bf27d411edccbe4"
 
 	tx, err := cli.GetTransactionByHash(hash)
@@ -82,7 +119,7 @@ func TestGetTransactionByHash(t *testing.T) {
 }
 
 func TestContractCreate(t *testing.T) {
-	cli := New("106.12.186.114:6001", "0x60a17Ef1B8b22e89cd6d19bcCD275863d98F2091")
+	cli := New("106.12.186.114:6001", "0x60a17Ef1B8b22e89cd6d19bcCD275863d98F2091", testChainId)
 
 	addr, err := cli.ContractCreate("608060405234801561001057600080fd5b50600860ff16600a0a633b9aca0002600181905550600860ff16600a0a633b9aca00026000803373ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff168152602001908152602001600020819055503373ffffffffffffffffffffffffffffffffffffffff16738e6ea506b6e4c770a5df3e4d1886ae60d216bb2c73ffffffffffffffffffffffffffffffffffffffff167fddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef600860ff16600a0a633b9aca00026040518082815260200191505060405180910390a36112228061010a6000396000f3fe608060405234801561001057600080fd5b50600436106100b45760003560e01c80636618846311610071578063661884631461028857806370a08231146102ee57806395d89b4114610346578063a9059cbb146103c9578063d73dd6231461042f578063dd62ed3e14610495576100b4565b806306fdde03146100b9578063095ea7b31461013c57806318160ddd146101a257806323b872dd146101c05780632ff2e9dc14610246578063313ce56714610264575b600080fd5b6100c161050d565b6040518080602001828103825283818151815260200191508051906020019080838360005b838110156101015780820151818401526020810190506100e6565b50505050905090810190601f16801561012e5780820380516001836020036101000a031916815260200191505b509250505060405180910390f35b6101886004803603604081101561015257600080fd5b81019080803573ffffffffffffffffffffffffffffffffffffffff16906020019092919080359060200190929190505050610546565b604051808215151515815260200191505060405180910390f35b6101aa610638565b6040518082815260200191505060405180910390f35b61022c600480360360608110156101d657600080fd5b81019080803573ffffffffffffffffffffffffffffffffffffffff169060200190929190803573ffffffffffffffffffffffffffffffffffffffff16906020019092919080359060200190929190505050610642565b604051808215151515815260200191505060405180910390f35b61024e6109f6565b6040518082815260200191505060405180910390f35b61026c610a07565b604051808260ff1660ff16815260200191505060405180910390f35b6102d46004803603604081101561029e57600080fd5b81019080803573ffffffffffffffffffffffffffffffffffffffff16906020019092919080359060200190929190505050610a0c565b604051808215151515815260200191505060405180910390f35b6103306004803603602081101561030457600080fd5b81019080803573ffffffffffffffffffffffffffffffffffffffff169060200190929190505050610c9d565b6040518082815260200191505060405180910390f35b61034e610ce5565b6040518080602001828103825283818151815260200191508051906020019080838360005b8381101561038e578082015181840152602081019050610373565b50505050905090810190601f1680156103bb5780820380516001836020036101000a031916815260200191505b509250505060405180910390f35b610415600480360360408110156103df57600080fd5b81019080803573ffffffffffffffffffffffffffffffffffffffff16906020019092919080359060200190929190505050610d1e565b604051808215151515815260200191505060405180910390f35b61047b6004803603604081101561044557600080fd5b81019080803573ffffffffffffffffffffffffffffffffffffffff16906020019092919080359060200190929190505050610f39565b604051808215151515815260200191505060405180910390f35b6104f7600480360360408110156104ab57600080fd5b81019080803573ffffffffffffffffffffffffffffffffffffffff169060200190929190803573ffffffffffffffffffffffffffffffffffffffff169060200190929190505050611135565b6040518082815260200191505060405180910390f35b6040518060400160405280601081526020017f666569796920746f6b656e20636f696e0000000000000000000000000000000081525081565b600081600260003373ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff16815260200190815260200160002060008573ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff168152602001908152602001600020819055508273ffffffffffffffffffffffffffffffffffffffff163373ffffffffffffffffffffffffffffffffffffffff167f8c5be1e5ebec7d5bd14f71427d1e84f3dd0314c0f7b2291e5b200ac8c7c3b925846040518082815260200191505060405180910390a36001905092915050565b6000600154905090565b60008073ffffffffffffffffffffffffffffffffffffffff168373ffffffffffffffffffffffffffffffffffffffff16141561067d57600080fd5b6000808573ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff168152602001908152602001600020548211156106c857600080fd5b600260008573ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff16815260200190815260200160002060003373ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff1681526020019081526020016000205482111561075157600080fd5b6107a2826000808773ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff168152602001908152602001600020546111bc90919063ffffffff16565b6000808673ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff16815260200190815260200160002081905550610835826000808673ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff168152602001908152602001600020546111d390919063ffffffff16565b6000808573ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff1681526020019081526020016000208190555061090682600260008773ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff16815260200190815260200160002060003373ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff168152602001908152602001600020546111bc90919063ffffffff16565b600260008673ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff16815260200190815260200160002060003373ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff168152602001908152602001600020819055508273ffffffffffffffffffffffffffffffffffffffff168473ffffffffffffffffffffffffffffffffffffffff167fddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef846040518082815260200191505060405180910390a3600190509392505050565b600860ff16600a0a633b9aca000281565b600881565b600080600260003373ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff16815260200190815260200160002060008573ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff16815260200190815260200160002054905080831115610b1d576000600260003373ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff16815260200190815260200160002060008673ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff16815260200190815260200160002081905550610bb1565b610b3083826111bc90919063ffffffff16565b600260003373ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff16815260200190815260200160002060008673ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff168152602001908152602001600020819055505b8373ffffffffffffffffffffffffffffffffffffffff163373ffffffffffffffffffffffffffffffffffffffff167f8c5be1e5ebec7d5bd14f71427d1e84f3dd0314c0f7b2291e5b200ac8c7c3b925600260003373ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff16815260200190815260200160002060008873ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff168152602001908152602001600020546040518082815260200191505060405180910390a3600191505092915050565b60008060008373ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff168152602001908152602001600020549050919050565b6040518060400160405280600481526020017f465954430000000000000000000000000000000000000000000000000000000081525081565b60008073ffffffffffffffffffffffffffffffffffffffff168373ffffffffffffffffffffffffffffffffffffffff161415610d5957600080fd5b6000803373ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff16815260200190815260200160002054821115610da457600080fd5b610df5826000803373ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff168152602001908152602001600020546111bc90919063ffffffff16565b6000803373ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff16815260200190815260200160002081905550610e88826000808673ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff168152602001908152602001600020546111d390919063ffffffff16565b6000808573ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff168152602001908152602001600020819055508273ffffffffffffffffffffffffffffffffffffffff163373ffffffffffffffffffffffffffffffffffffffff167fddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef846040518082815260200191505060405180910390a36001905092915050565b6000610fca82600260003373ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff16815260200190815260200160002060008673ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff168152602001908152602001600020546111d390919063ffffffff16565b600260003373ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff16815260200190815260200160002060008573ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff168152602001908152602001600020819055508273ffffffffffffffffffffffffffffffffffffffff163373ffffffffffffffffffffffffffffffffffffffff167f8c5be1e5ebec7d5bd14f71427d1e84f3dd0314c0f7b2291e5b200ac8c7c3b925600260003373ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff16815260200190815260200160002060008773ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff168152602001908152602001600020546040518082815260200191505060405180910390a36001905092915050565b6000600260008473ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff16815260200190815260200160002060008373ffffffffffffffffffffffffffffffffffffffff1673ffffffffffffffffffffffffffffffffffffffff16815260200190815260200160002054905092915050565b6000828211156111c857fe5b818303905092915050565b60008183019050828110156111e457fe5b8090509291505056fea265627a7a72315820616f72583f8050f60afced1212c55d820d5674f1e2d4d0de032af2c6d50e807364736f6c634300050b0032", "0xf978BB6c574b355E327ADb27321dCd81455BFf90")
 	if err != nil {
@@ -94,7 +131,7 @@ func TestContractCreate(t *testing.T) {
 }
 
 func TestContractCall(t *testing.T) {
-	cli := New("106.12.186.114:6001", "0x60a17Ef1B8b22e89cd6d19bcCD275863d98F2091")
+	cli := New("106.12.186.114:6001", "0x60a17Ef1B8b22e89cd6d19bcCD275863d98F2091", testChainId)
 	ret, err := cli.ContractCall("", "0xA947a3FdCA6cDb7E907f3d727d605439cd1E2EBA", "70a08231000000000000000000000000678593e9b62b22be0b04588aa92f7d9d6370f999")
 	if err != nil {
 		t.Error(err)
@@ -104,7 +141,7 @@ func TestContractCall(t *testing.T) {
 }
 
 func TestSendRawTransaction(t *testing.T) {
-	cli := New("106.12.186.114:6001", "0x60a17Ef1B8b22e89cd6d19bcCD275863d98F2091")
+	cli := New("106.12.186.114:6001", "0x60a17Ef1B8b22e89cd6d19bcCD275863d98F2091", testChainId)
 	var raw = "0xf86909808307a1209460a17ef1b8b22e89cd6d19bccd275863d98f209187038d7ea4c68000808240dea0204cf7e7ae2eb918e3bd22371fb29a3126655d07afdc0105289aad6ddc61b5fea07c5ff81f8f29c847cb8f7d4e950d2f91fb79745d512118d7105bb31f10d36774"
 	h, err := cli.SendRawTransaction(raw)
 	if err != nil {
@@ -117,7 +154,7 @@ func TestSendRawTransaction(t *testing.T) {
 
 func TestGetCode(t *testing.T) {
 
-	cli := New("106.12.186.114:6001", "0x60a17Ef1B8b22e89cd6d19bcCD275863d98F2091")
+	cli := New("106.12.186.114:6001", "0x60a17Ef1B8b22e89cd6d19bcCD275863d98F2091", testChainId)
 
 	code, err := cli.GetCode("0x403148bd4835646bcb6da18cf41d2b50391099b8")
 	if err != nil {
@@ -128,7 +165,7 @@ func TestGetCode(t *testing.T) {
 }
 
 func TestGetNonce(t *testing.T) {
-	cli := New("106.12.186.114:6001", "0x60a17Ef1B8b22e89cd6d19bcCD275863d98F2091")
+	cli := New("106.12.186.114:6001", "0x60a17Ef1B8b22e89cd6d19bcCD275863d98F2091", testChainId)
 	n, err := cli.GetNonce("0xd8aE0197425C0eA651264b06978580DcB62f3c91")
 	if err != nil {
 		t.Error(err)
@@ -136,3 +173,36 @@ func TestGetNonce(t *testing.T) {
 	}
 	t.Logf("GetCode OK,0xd8aE0197425C0eA651264b06978580DcB62f3c91 nonce:%v\n", n)
 }
+
+func TestDecodeRawTx(t *testing.T) {
+	legacy := "0xf86909808307a1209460a17ef1b8b22e89cd6d19bccd275863d98f209187038d7ea4c68000808240dea0204cf7e7ae2eb918e3bd22371fb29a3126655d07afdc0105289aad6ddc61b5fea07c5ff81f8f29c847cb8f7d4e950d2f91fb79745d512118d7105bb31f10d36774"
+	if _, _, err := decodeRawTx(legacy, testChainId); err != nil {
+		t.Errorf("legacy tx: %v", err)
+	}
+	if _, _, err := decodeRawTx(legacy, big.NewInt(1)); err == nil {
+		t.Error("expected a chain id mismatch error")
+	}
+
+	key, _ := crypto.GenerateKey()
+	to := common.HexToAddress("0x60a17Ef1B8b22e89cd6d19bcCD275863d98F2091")
+	signer := types.NewLondonSigner(testChainId)
+	for _, inner := range []types.TxData{
+		&types.AccessListTx{ChainID: testChainId, Nonce: 1, To: &to, Gas: 21000, GasPrice: big.NewInt(1), AccessList: types.AccessList{{Address: to}}},
+		&types.DynamicFeeTx{ChainID: testChainId, Nonce: 2, To: &to, Gas: 21000, GasFeeCap: big.NewInt(2), GasTipCap: big.NewInt(1)},
+	} {
+		tx := types.MustSignNewTx(key, signer, inner)
+		raw, _ := tx.MarshalBinary()
+		dec, sender, err := decodeRawTx(hexutil.Encode(raw), testChainId)
+		if err != nil {
+			t.Errorf("type %d: %v", tx.Type(), err)
+			continue
+		}
+		if sender != crypto.PubkeyToAddress(key.PublicKey) || dec.Hash() != tx.Hash() {
+			t.Errorf("type %d: wrong sender %v or hash %v", tx.Type(), sender, dec.Hash())
+		}
+	}
+
+	if _, _, err := decodeRawTx("0x05c0", testChainId); err == nil {
+		t.Error("expected unsupported tx type error")
+	}
+}
@@ -3,16 +3,17 @@ package client
 import (
 	"kortho/block"
 	"kortho/transaction"
+	"math/big"
 )
 
 type Client interface {
-	SendTransaction(string, string, string, uint64) (string, error)
+	SendTransaction(string, string, string, *big.Int) (string, error)
 	//ContractCreate(createCode string, origin string, contractName string, from, to, priv string, amount uint64, option string) (string, error)
 	ContractCreate(createCode string, origin string) (string, error)
 	//ContractCall(origin string, contractAddr string, callInput string, from, to, priv string, amount uint64, option string) (string, error)
 	ContractCall(origin string, contractAddr string, callInput string) (string, error)
 	GetBlockNumber() (uint64, error)
-	GetBalance(from string) (uint64, error)
+	GetBalance(from string) (*big.Int, error)
 	GetBlockByHash(hash string) (*block.Block, error)
 	GetBlockByNumber(num uint64) (*block.Block, error)
 	GetCode(contractAddr string) (string, error)
@@ -25,11 +25,69 @@ func main() {
 	chainId := viper.GetString("chainId")
 	networkId := viper.GetString("networkId")
 	ethTo := viper.GetString("ethTo")
+	batchLimit := viper.GetInt("batchLimit")
+	apis := viper.GetStringSlice("apis")
+	maxSubs := viper.GetInt("ws.maxSubscriptions")
+	pollInterval := viper.GetDuration("ws.pollInterval")
+	filterTimeout := viper.GetDuration("filter.timeout")
+	maxFilters := viper.GetInt("filter.maxPerClient")
+	maxFiltersTotal := viper.GetInt("filter.maxTotal")
+	trustedProxies := viper.GetStringSlice("trustedProxies")
+	txIndexPath := viper.GetString("txIndex.path")
+	rejectUnprotected := viper.GetBool("rejectUnprotectedTxs")
+	decimals := viper.GetInt("decimals")
+	keystoreDir := viper.GetString("keystore.dir")
+	allowInsecureUnlock := viper.GetBool("keystore.allowInsecureUnlock")
+	wsOrigins := viper.GetStringSlice("ws.origins")
+	localCalls := viper.GetBool("evm.local")
+	verifyCalls := viper.GetBool("evm.verify")
+	errorABIs := viper.GetStringSlice("revert.abis")
+	logsMaxRange := viper.GetUint64("logs.maxRange")
+	logsMaxResults := viper.GetInt("logs.maxResults")
+	logsChunkSize := viper.GetUint64("logs.chunkSize")
 
 	certf := viper.GetString("tls.cert")
 	keyf := viper.GetString("tls.key")
 
-	s := api.NewServer(addr, chainId, networkId, ethTo)
+	s, err := api.NewServer(&api.Config{
+		RpcAddr:    addr,
+		ChainId:    chainId,
+		NetworkId:  networkId,
+		EthTo:      ethTo,
+		BatchLimit: batchLimit,
+		Namespaces: apis,
+
+		MaxSubscriptions: maxSubs,
+		PollInterval:     pollInterval,
+
+		FilterTimeout:   filterTimeout,
+		MaxFilters:      maxFilters,
+		MaxFiltersTotal: maxFiltersTotal,
+
+		TrustedProxies: trustedProxies,
+
+		TxIndexPath:          txIndexPath,
+		RejectUnprotectedTxs: rejectUnprotected,
+
+		Decimals:    decimals,
+		KeystoreDir: keystoreDir,
+
+		AllowInsecureUnlock: allowInsecureUnlock,
+		WsOrigins:           wsOrigins,
+
+		LocalCalls:  localCalls,
+		VerifyCalls: verifyCalls,
+
+		ErrorABIs: errorABIs,
+
+		LogsMaxRange:   logsMaxRange,
+		LogsMaxResults: logsMaxResults,
+		LogsChunkSize:  logsChunkSize,
+	})
+	if err != nil {
+		log.Println("NewServer fail:", err.Error())
+		os.Exit(1)
+	}
 	http.HandleFunc("/", s.HandRequest)
 
 	if certf != "" && keyf != "" {